@@ -0,0 +1,344 @@
+// Package action implements the steps that run natively instead of through
+// a shell: writing files, symlinks, templates, downloads and directories.
+//
+// Every action knows when it is already applied (see Done), so running a
+// plan twice leaves the system unchanged.
+package action
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// Default permissions of the files and directories actions create.
+const (
+	DefaultFileMode fs.FileMode = 0o644
+	DefaultDirMode  fs.FileMode = 0o755
+)
+
+// WriteFile writes Content to Path, replacing the file.
+type WriteFile struct {
+	Path    string
+	Content string
+	Mode    fs.FileMode // 0 means DefaultFileMode
+}
+
+// Done reports whether the file already has Content.
+func (a WriteFile) Done() (bool, error) {
+	return hasContent(ExpandHome(a.Path), []byte(a.Content))
+}
+
+// Apply writes the file.
+func (a WriteFile) Apply(_ context.Context, out io.Writer) error {
+	fmt.Fprintf(out, "Escribiendo %s\n", a.Path)
+	return writeFile(ExpandHome(a.Path), []byte(a.Content), a.Mode)
+}
+
+func (a WriteFile) String() string { return "escribir " + a.Path }
+
+// AppendFile appends Content to Path unless the file already contains it,
+// e.g. a line of a shell profile.
+type AppendFile struct {
+	Path    string
+	Content string
+	Mode    fs.FileMode // used when the file is created, 0 means DefaultFileMode
+}
+
+// Done reports whether the file already contains Content.
+func (a AppendFile) Done() (bool, error) {
+	data, err := os.ReadFile(ExpandHome(a.Path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Contains(data, []byte(strings.TrimSuffix(a.Content, "\n"))), nil
+}
+
+// Apply appends Content on a line of its own.
+func (a AppendFile) Apply(_ context.Context, out io.Writer) error {
+	path := ExpandHome(a.Path)
+	fmt.Fprintf(out, "Agregando a %s\n", a.Path)
+	if err := os.MkdirAll(filepath.Dir(path), DefaultDirMode); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, fileMode(a.Mode))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	content := a.Content
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	// Start on a new line if the file does not end with one.
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			content = "\n" + content
+		}
+	}
+	if _, err := io.WriteString(f, content); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (a AppendFile) String() string { return "agregar a " + a.Path }
+
+// Symlink links Path to Target, replacing an existing symlink.
+type Symlink struct {
+	Path   string
+	Target string
+}
+
+// Done reports whether Path already links to Target.
+func (a Symlink) Done() (bool, error) {
+	dest, err := os.Readlink(ExpandHome(a.Path))
+	if err != nil {
+		return false, nil
+	}
+	return dest == ExpandHome(a.Target), nil
+}
+
+// Apply creates the symlink. Path may only be replaced if it is a symlink
+// itself, so no file or directory is ever lost.
+func (a Symlink) Apply(_ context.Context, out io.Writer) error {
+	path := ExpandHome(a.Path)
+	fmt.Fprintf(out, "Enlazando %s -> %s\n", a.Path, a.Target)
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&fs.ModeSymlink == 0 {
+			return fmt.Errorf("%s ya existe y no es un symlink", a.Path)
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), DefaultDirMode); err != nil {
+		return err
+	}
+	return os.Symlink(ExpandHome(a.Target), path)
+}
+
+func (a Symlink) String() string { return fmt.Sprintf("symlink %s -> %s", a.Path, a.Target) }
+
+// TemplateData is what templates can refer to, e.g. {{.Home}}.
+type TemplateData struct {
+	Home     string
+	User     string
+	Hostname string
+}
+
+// Template renders the Go template Text to Path.
+type Template struct {
+	Path string
+	Text string
+	Mode fs.FileMode // 0 means DefaultFileMode
+}
+
+// Done reports whether the file already has the rendered content.
+func (a Template) Done() (bool, error) {
+	content, err := a.Render()
+	if err != nil {
+		return false, err
+	}
+	return hasContent(ExpandHome(a.Path), content)
+}
+
+// Apply renders the template and writes the file.
+func (a Template) Apply(_ context.Context, out io.Writer) error {
+	content, err := a.Render()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Generando %s\n", a.Path)
+	return writeFile(ExpandHome(a.Path), content, a.Mode)
+}
+
+func (a Template) String() string { return "generar " + a.Path + " desde una plantilla" }
+
+// Render executes the template for the current user and machine.
+func (a Template) Render() ([]byte, error) {
+	t, err := template.New(a.Path).Option("missingkey=error").Parse(a.Text)
+	if err != nil {
+		return nil, err
+	}
+	data := TemplateData{}
+	data.Home, _ = os.UserHomeDir()
+	data.Hostname, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		data.User = u.Username
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Download fetches URL into Path and checks its SHA-256.
+type Download struct {
+	URL    string
+	Path   string
+	SHA256 string      // hex encoded
+	Mode   fs.FileMode // 0 means DefaultFileMode
+}
+
+// Done reports whether Path already has the expected checksum.
+func (a Download) Done() (bool, error) {
+	f, err := os.Open(ExpandHome(a.Path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return false, err
+	}
+	return strings.EqualFold(hex.EncodeToString(h.Sum(nil)), a.SHA256), nil
+}
+
+// Apply downloads the file next to Path and moves it into place once the
+// checksum matches, so a failed download never leaves a broken file.
+func (a Download) Apply(ctx context.Context, out io.Writer) error {
+	path := ExpandHome(a.Path)
+	fmt.Fprintf(out, "Descargando %s\n", a.URL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", a.URL, resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), DefaultDirMode); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), resp.Body)
+	if err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, a.SHA256) {
+		return fmt.Errorf("sha256 de %s no coincide: se esperaba %s, se obtuvo %s", a.URL, a.SHA256, sum)
+	}
+	fmt.Fprintf(out, "Descargados %d bytes, sha256 verificado\n", n)
+	if err := tmp.Chmod(fileMode(a.Mode)); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (a Download) String() string {
+	return fmt.Sprintf("descargar %s en %s (sha256 %.12s)", a.URL, a.Path, a.SHA256)
+}
+
+// Mkdir creates the directory Path and its parents.
+type Mkdir struct {
+	Path string
+	Mode fs.FileMode // 0 means DefaultDirMode
+}
+
+// Done reports whether Path already is a directory.
+func (a Mkdir) Done() (bool, error) {
+	info, err := os.Stat(ExpandHome(a.Path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !info.IsDir() {
+		return false, fmt.Errorf("%s ya existe y no es un directorio", a.Path)
+	}
+	return true, nil
+}
+
+// Apply creates the directory.
+func (a Mkdir) Apply(_ context.Context, out io.Writer) error {
+	fmt.Fprintf(out, "Creando %s\n", a.Path)
+	mode := a.Mode
+	if mode == 0 {
+		mode = DefaultDirMode
+	}
+	return os.MkdirAll(ExpandHome(a.Path), mode)
+}
+
+func (a Mkdir) String() string { return "crear directorio " + a.Path }
+
+// ExpandHome replaces a leading "~/" in path with the home directory.
+func ExpandHome(path string) string {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, rest)
+}
+
+// hasContent reports whether the file at path holds exactly content.
+func hasContent(path string, content []byte) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(data, content), nil
+}
+
+// writeFile atomically replaces the file at path, creating its directory.
+func writeFile(path string, content []byte, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), DefaultDirMode); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, fileMode(mode)); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// fileMode returns mode, or DefaultFileMode when it is zero.
+func fileMode(mode fs.FileMode) fs.FileMode {
+	if mode == 0 {
+		return DefaultFileMode
+	}
+	return mode
+}
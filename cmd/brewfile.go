@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"paisanos-cli/cmd/brewfile"
+	"paisanos-cli/cmd/catalog"
+
+	"github.com/spf13/cobra"
+)
+
+// Flags of brewfile export.
+var (
+	brewfileOutput string // file the Brewfile is written to, - for stdout
+	brewfileForce  bool   // overwrite an existing file
+)
+
+// BrewfileCmd groups the commands that share the setup with `brew bundle`.
+var BrewfileCmd = &cobra.Command{
+	Use:   "brewfile",
+	Short: "Comparte el setup como Brewfile de `brew bundle`",
+	Long: `Comparte el setup como Brewfile de ` + "`brew bundle`" + `.
+
+Para instalar un Brewfile existente junto con el catálogo usá
+` + "`paisanos setup --brewfile Brewfile`" + `.`,
+}
+
+// brewfileExportCmd writes the packages setup would install as a Brewfile.
+var brewfileExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Escribe las fórmulas, casks y taps seleccionados como Brewfile",
+	Long: `Escribe las fórmulas, casks, apps de la App Store y taps que instalaría
+setup como Brewfile, para usarlo con ` + "`brew bundle`" + ` o compartirlo.
+
+Sin --profile se exportan los paquetes base del catálogo, como los que
+instala setup sin perfiles; el editor solo se incluye si se elige con
+--editor.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := cmd.ErrOrStderr()
+		cat := loadCatalog(out)
+
+		packages := cat.DefaultPackages()
+		if len(profiles) > 0 {
+			var err error
+			if packages, err = cat.ProfilePackages(profiles); err != nil {
+				return err
+			}
+		}
+		if editorName != "" {
+			editor, ok := cat.Find(editorName)
+			if !ok || !slices.Contains(cat.EditorNames(), editorName) {
+				return fmt.Errorf("editor desconocido: %q (%s)", editorName, strings.Join(cat.EditorNames(), ", "))
+			}
+			packages = append(packages, editor)
+		}
+		taps := packageTaps(nil, packages)
+
+		if brewfileOutput == "-" {
+			return brewfile.Write(cmd.OutOrStdout(), taps, packages)
+		}
+		flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+		if brewfileForce {
+			flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		}
+		f, err := os.OpenFile(brewfileOutput, flags, 0o644)
+		if os.IsExist(err) {
+			return fmt.Errorf("%s ya existe: usá --force para reemplazarlo", brewfileOutput)
+		}
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := brewfile.Write(f, taps, packages); err != nil {
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Brewfile escrito en %s (%d paquetes, %d taps)\n", brewfileOutput, len(packages), len(taps))
+		return nil
+	},
+}
+
+// mergePackages appends the packages of extra that are not in packages
+// yet. Catalog entries win, since they carry probes and checks.
+func mergePackages(packages, extra []catalog.Package) []catalog.Package {
+	for _, pkg := range extra {
+		id := packageStepID(pkg)
+		if !slices.ContainsFunc(packages, func(p catalog.Package) bool { return packageStepID(p) == id }) {
+			packages = append(packages, pkg)
+		}
+	}
+	return packages
+}
+
+// packageTaps returns taps followed by the taps of the packages named with
+// one, without duplicates. Adding them up front keeps parallel installs
+// from tapping the same repository at once.
+func packageTaps(taps []string, packages []catalog.Package) []string {
+	taps = slices.Clone(taps)
+	for _, pkg := range packages {
+		if tap := pkg.Tap(); tap != "" && !slices.Contains(taps, tap) {
+			taps = append(taps, tap)
+		}
+	}
+	return taps
+}
+
+func init() {
+	brewfileExportCmd.Flags().StringVarP(&brewfileOutput, "file", "f", "Brewfile", "archivo donde escribir el Brewfile, o - para stdout")
+	brewfileExportCmd.Flags().BoolVar(&brewfileForce, "force", false, "reemplaza el archivo si ya existe")
+	brewfileExportCmd.Flags().StringVar(&manifestPath, "manifest", "", "ruta a un manifiesto YAML que reemplaza al catálogo embebido")
+	brewfileExportCmd.Flags().StringVar(&catalogURL, "catalog", os.Getenv("PAISANOS_CATALOG"), "catálogo remoto del equipo: una URL https o un remoto de git; por defecto $PAISANOS_CATALOG")
+	brewfileExportCmd.Flags().StringSliceVar(&profiles, "profile", nil, "perfiles del catálogo a exportar, separados por coma (ej. frontend,design)")
+	brewfileExportCmd.Flags().StringVar(&editorName, "editor", "", "editor a incluir en el Brewfile")
+	BrewfileCmd.AddCommand(brewfileExportCmd)
+	RootCmd.AddCommand(BrewfileCmd)
+}
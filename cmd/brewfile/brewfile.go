@@ -0,0 +1,198 @@
+// Package brewfile reads and writes Brewfiles, the manifests of
+// `brew bundle`, as taps and catalog packages.
+package brewfile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"paisanos-cli/cmd/catalog"
+)
+
+// Header is the comment written at the top of exported Brewfiles.
+const Header = "# Generado por paisanos brewfile export."
+
+// MasFormula is the formula that installs App Store apps, added to every
+// Brewfile with mas entries.
+const MasFormula = "mas"
+
+var (
+	// entryRe matches an entry: its type and the quoted name, followed by
+	// its options.
+	entryRe = regexp.MustCompile(`^([a-z_]+)\s+(?:"([^"]*)"|'([^']*)')(.*)$`)
+	// masIDRe matches the App Store ID option of a mas entry.
+	masIDRe = regexp.MustCompile(`\bid:\s*(\d+)`)
+	// wordRe matches the type of a line that is not an entry paisanos
+	// understands.
+	wordRe = regexp.MustCompile(`^[a-z_]+\b`)
+	// blockRe matches a Ruby line that opens a block closed by "end".
+	blockRe = regexp.MustCompile(`^(?:if|unless|case|while|until|for|begin)\b|\bdo(?:\s*\|[^|]*\|)?$`)
+	// modifierRe matches a trailing if or unless in the options of an
+	// entry, as in `brew "foo" if OS.mac?`.
+	modifierRe = regexp.MustCompile(`\b(?:if|unless)\b`)
+	// quotedRe matches a quoted string, ignored when looking for modifiers.
+	quotedRe = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+)
+
+// File is a parsed Brewfile.
+type File struct {
+	Source   string
+	Taps     []string
+	Packages []catalog.Package
+	// Skipped are the entries paisanos cannot install, like vscode or
+	// whalebrew ones, or taps with a custom URL.
+	Skipped []Line
+}
+
+// Line is a line of a Brewfile.
+type Line struct {
+	Number int
+	Text   string
+	// Conditional is set on the lines of Ruby conditions and loops, and
+	// on the entries they guard, which paisanos cannot evaluate.
+	Conditional bool
+}
+
+// Load reads and parses the Brewfile at path.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(path, data)
+}
+
+// Parse parses the tap, brew, cask and mas entries of a Brewfile read from
+// source. Their options, like args or restart_service, are ignored. Other
+// entries are listed in Skipped, and so are lines that are Ruby code rather
+// than entries, since a Brewfile is a Ruby script. Entries inside Ruby
+// blocks or with a trailing if or unless are skipped too: installing them
+// unconditionally could install what the Brewfile excludes.
+func Parse(source string, data []byte) (*File, error) {
+	f := &File{Source: source}
+	seen := make(map[string]bool)
+	add := func(pkg catalog.Package) {
+		key := string(pkg.Kind) + ":" + pkg.Name
+		if !seen[key] {
+			seen[key] = true
+			f.Packages = append(f.Packages, pkg)
+		}
+	}
+
+	depth := 0 // of the Ruby blocks around the line
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		code := strings.TrimSpace(stripComment(text))
+		switch {
+		case blockRe.MatchString(code):
+			depth++
+		case wordRe.FindString(code) == "end" && depth > 0:
+			depth--
+			f.Skipped = append(f.Skipped, Line{Number: n, Text: text, Conditional: true})
+			continue
+		}
+		if depth > 0 {
+			f.Skipped = append(f.Skipped, Line{Number: n, Text: text, Conditional: true})
+			continue
+		}
+		m := entryRe.FindStringSubmatch(text)
+		if m == nil {
+			if w := wordRe.FindString(text); slices.Contains([]string{"tap", "brew", "cask", "mas"}, w) {
+				return nil, &catalog.Error{File: source, Line: n, Msg: fmt.Sprintf("%s entry without a quoted name", w)}
+			}
+			f.Skipped = append(f.Skipped, Line{Number: n, Text: text})
+			continue
+		}
+		kind, name, options := m[1], m[2]+m[3], stripComment(m[4])
+		if name == "" {
+			return nil, &catalog.Error{File: source, Line: n, Msg: fmt.Sprintf("%s entry with an empty name", kind)}
+		}
+		if modifierRe.MatchString(quotedRe.ReplaceAllString(options, "")) {
+			f.Skipped = append(f.Skipped, Line{Number: n, Text: text, Conditional: true})
+			continue
+		}
+		switch kind {
+		case "tap":
+			// A second argument is the URL of a tap outside GitHub.
+			if strings.HasPrefix(strings.TrimSpace(options), ",") {
+				f.Skipped = append(f.Skipped, Line{Number: n, Text: text})
+				continue
+			}
+			if !slices.Contains(f.Taps, name) {
+				f.Taps = append(f.Taps, name)
+			}
+		case "brew":
+			add(catalog.Package{Name: name, Kind: catalog.KindFormula, Line: n})
+		case "cask":
+			add(catalog.Package{Name: name, Kind: catalog.KindCask, Line: n})
+		case "mas":
+			id := masIDRe.FindStringSubmatch(options)
+			if id == nil {
+				return nil, &catalog.Error{File: source, Line: n, Msg: fmt.Sprintf("mas entry %q without id", name)}
+			}
+			appID, err := strconv.ParseInt(id[1], 10, 64)
+			if err != nil || appID <= 0 {
+				return nil, &catalog.Error{File: source, Line: n, Msg: fmt.Sprintf("mas entry %q: invalid id %s", name, id[1])}
+			}
+			add(catalog.Package{Name: name, Kind: catalog.KindMas, ID: appID, Line: n})
+		default:
+			f.Skipped = append(f.Skipped, Line{Number: n, Text: text})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	// mas itself has to be installed before any App Store app.
+	if slices.ContainsFunc(f.Packages, func(p catalog.Package) bool { return p.Kind == catalog.KindMas }) {
+		add(catalog.Package{Name: MasFormula, Kind: catalog.KindFormula})
+	}
+	return f, nil
+}
+
+// stripComment drops a trailing comment from the options of an entry.
+func stripComment(options string) string {
+	if i := strings.Index(options, "#"); i >= 0 {
+		return options[:i]
+	}
+	return options
+}
+
+// Write writes taps and packages as a Brewfile: taps first, then formulae,
+// casks and App Store apps, each group in the given order, as
+// `brew bundle dump` does.
+func Write(w io.Writer, taps []string, packages []catalog.Package) error {
+	var b strings.Builder
+	b.WriteString(Header + "\n")
+	for _, tap := range taps {
+		fmt.Fprintf(&b, "tap %q\n", tap)
+	}
+	for _, pkg := range packages {
+		if pkg.Kind == catalog.KindFormula {
+			fmt.Fprintf(&b, "brew %q\n", pkg.Name)
+		}
+	}
+	for _, pkg := range packages {
+		if pkg.Kind == catalog.KindCask {
+			fmt.Fprintf(&b, "cask %q\n", pkg.Name)
+		}
+	}
+	for _, pkg := range packages {
+		if pkg.Kind == catalog.KindMas {
+			fmt.Fprintf(&b, "mas %q, id: %d\n", pkg.Name, pkg.ID)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,189 @@
+package brewfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"paisanos-cli/cmd/catalog"
+)
+
+const sample = `# Brewfile de ejemplo
+tap "homebrew/cask-fonts"
+tap 'hashicorp/tap'
+tap "acme/private", "https://git.example.com/acme/homebrew-private.git"
+brew "git"
+brew 'fnm'
+brew "postgresql@17", restart_service: :changed
+brew "neovim", args: ["HEAD"] # nightly
+brew "hashicorp/tap/terraform"
+brew "git"
+cask "font-fira-code"
+cask "firefox", args: { appdir: "~/Applications" }
+mas "Xcode", id: 497799835
+mas 'Amphetamine',id:937984704
+vscode "golang.go"
+whalebrew "whalebrew/wget"
+if OS.mac?
+  brew "only-on-mac"
+end
+cask_args appdir: "/Applications"
+brew "only-on-linux" if OS.linux?
+cask "docker", args: { appdir: "/Applications" } unless ENV["CI"] # local only
+brew "ifstat", args: ["if"]
+["jq", "yq"].each do |f|
+  brew f
+end
+`
+
+// entries returns the packages as Brewfile-like strings, easier to compare
+// than catalog.Package values.
+func entries(pkgs []catalog.Package) []string {
+	var out []string
+	for _, p := range pkgs {
+		s := string(p.Kind) + " " + p.Name
+		if p.ID != 0 {
+			s += fmt.Sprintf(" %d", p.ID)
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestParse(t *testing.T) {
+	f, err := Parse("Brewfile", []byte(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"homebrew/cask-fonts", "hashicorp/tap"}; !slices.Equal(f.Taps, want) {
+		t.Errorf("Taps = %q, want %q", f.Taps, want)
+	}
+	want := []string{
+		"formula git",
+		"formula fnm",
+		"formula postgresql@17",
+		"formula neovim",
+		"formula hashicorp/tap/terraform",
+		"cask font-fira-code",
+		"cask firefox",
+		"mas Xcode 497799835",
+		"mas Amphetamine 937984704",
+		"formula ifstat",
+		"formula " + MasFormula,
+	}
+	if got := entries(f.Packages); !slices.Equal(got, want) {
+		t.Errorf("Packages = %q, want %q", got, want)
+	}
+	if f.Packages[0].Line != 5 || f.Packages[3].Line != 8 {
+		t.Errorf("Lines = %d, %d, want 5, 8", f.Packages[0].Line, f.Packages[3].Line)
+	}
+
+	var skipped []int
+	for _, l := range f.Skipped {
+		skipped = append(skipped, l.Number)
+	}
+	// The tap with a URL, vscode, whalebrew, the Ruby lines and the
+	// conditional entries.
+	if want := []int{4, 15, 16, 17, 18, 19, 20, 21, 22, 24, 25, 26}; !slices.Equal(skipped, want) {
+		t.Errorf("Skipped lines = %v, want %v", skipped, want)
+	}
+	var conditional []int
+	for _, l := range f.Skipped {
+		if l.Conditional {
+			conditional = append(conditional, l.Number)
+		}
+	}
+	if want := []int{17, 18, 19, 21, 22, 24, 25, 26}; !slices.Equal(conditional, want) {
+		t.Errorf("Conditional lines = %v, want %v", conditional, want)
+	}
+	if f.Skipped[0].Text != `tap "acme/private", "https://git.example.com/acme/homebrew-private.git"` {
+		t.Errorf("Skipped[0] = %q", f.Skipped[0].Text)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		data string
+		line int
+		msg  string
+	}{
+		{"brew git\n", 1, "without a quoted name"},
+		{"# taps\ntap homebrew/core\n", 2, "without a quoted name"},
+		{`cask ""`, 1, "empty name"},
+		{`mas "Xcode"`, 1, "without id"},
+		{`mas "Xcode", id: 0`, 1, "invalid id"},
+		{`mas "Xcode", id: 99999999999999999999`, 1, "invalid id"},
+	}
+	for _, tt := range tests {
+		_, err := Parse("Brewfile", []byte(tt.data))
+		var catErr *catalog.Error
+		if !errors.As(err, &catErr) {
+			t.Errorf("Parse(%q) error = %v, want *catalog.Error", tt.data, err)
+			continue
+		}
+		if catErr.Line != tt.line || !strings.Contains(catErr.Msg, tt.msg) {
+			t.Errorf("Parse(%q) error = line %d %q, want line %d %q", tt.data, catErr.Line, catErr.Msg, tt.line, tt.msg)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	packages := []catalog.Package{
+		{Name: "Xcode", Kind: catalog.KindMas, ID: 497799835},
+		{Name: "slack", Kind: catalog.KindCask},
+		{Name: "git", Kind: catalog.KindFormula},
+		{Name: "mas", Kind: catalog.KindFormula},
+	}
+	var b bytes.Buffer
+	if err := Write(&b, []string{"hashicorp/tap"}, packages); err != nil {
+		t.Fatal(err)
+	}
+	want := Header + `
+tap "hashicorp/tap"
+brew "git"
+brew "mas"
+cask "slack"
+mas "Xcode", id: 497799835
+`
+	if b.String() != want {
+		t.Errorf("Write =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	f, err := Parse("Brewfile", []byte(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first bytes.Buffer
+	if err := Write(&first, f.Taps, f.Packages); err != nil {
+		t.Fatal(err)
+	}
+	g, err := Parse("export", first.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Skipped) > 0 {
+		t.Errorf("Skipped = %v, want none", g.Skipped)
+	}
+	if !slices.Equal(g.Taps, f.Taps) {
+		t.Errorf("Taps = %q, want %q", g.Taps, f.Taps)
+	}
+	got, want := entries(g.Packages), entries(f.Packages)
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("Packages = %q, want %q", got, want)
+	}
+
+	var second bytes.Buffer
+	if err := Write(&second, g.Taps, g.Packages); err != nil {
+		t.Fatal(err)
+	}
+	if second.String() != first.String() {
+		t.Errorf("second Write =\n%s\nwant\n%s", second.String(), first.String())
+	}
+}
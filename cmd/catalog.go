@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"paisanos-cli/cmd/catalog"
+
+	"github.com/spf13/cobra"
+)
+
+// signingKeyPath is the private key `paisanos catalog sign` signs with.
+var signingKeyPath string
+
+// CatalogCmd groups the commands for catalog maintainers.
+var CatalogCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: "Herramientas para quienes mantienen el catálogo del equipo",
+}
+
+// catalogSignCmd writes the detached signature of a manifest, which remote
+// catalogs need to be accepted by setup.
+var catalogSignCmd = &cobra.Command{
+	Use:   "sign <manifiesto.yaml>",
+	Short: "Firma un catálogo con la clave privada ed25519 del equipo",
+	Long: `Firma un catálogo con la clave privada ed25519 del equipo y escribe la
+firma junto al manifiesto (manifiesto.yaml.sig). Publicá ambos archivos en
+la misma URL o repositorio: setup rechaza los catálogos remotos sin una
+firma válida.
+
+La clave se genera con:
+
+    openssl genpkey -algorithm ed25519 -out catalog.key`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if signingKeyPath == "" {
+			return fmt.Errorf("falta la clave privada: usá --key o $PAISANOS_CATALOG_KEY")
+		}
+		path := args[0]
+		manifest, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// Never sign a catalog setup would reject anyway.
+		if _, err := catalog.Parse(path, manifest); err != nil {
+			return err
+		}
+		keyData, err := os.ReadFile(signingKeyPath)
+		if err != nil {
+			return err
+		}
+		key, err := catalog.ParsePrivateKey(keyData)
+		if err != nil {
+			return fmt.Errorf("%s: %w", signingKeyPath, err)
+		}
+
+		sig := catalog.Sign(key, manifest)
+		sigPath := path + catalog.SignatureSuffix
+		if err := os.WriteFile(sigPath, sig, 0o644); err != nil {
+			return err
+		}
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "Firma escrita en %s\n", sigPath)
+
+		// Signing with a new key before rotating catalog.pub is valid, but
+		// worth a warning: this binary would reject the catalog.
+		if err := catalog.Verify(path, manifest, sig); errors.Is(err, catalog.ErrNoPublicKey) {
+			fmt.Fprintln(out, warning("Este binario no trae la clave pública del equipo; setup va a rechazar el catálogo hasta que se agregue a catalog.pub."))
+		} else if err != nil {
+			fmt.Fprintln(out, warning("La clave no corresponde a la clave pública de este binario; setup va a rechazar el catálogo hasta que se actualice catalog.pub."))
+		}
+		return nil
+	},
+}
+
+func init() {
+	catalogSignCmd.Flags().StringVar(&signingKeyPath, "key", os.Getenv("PAISANOS_CATALOG_KEY"), "clave privada ed25519 en PEM; por defecto $PAISANOS_CATALOG_KEY")
+	CatalogCmd.AddCommand(catalogSignCmd)
+	RootCmd.AddCommand(CatalogCmd)
+}
@@ -0,0 +1,664 @@
+// Package catalog loads the declarative manifest that describes which
+// packages the setup command installs.
+package catalog
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed default.yaml
+var defaultManifest []byte
+
+// DefaultSource is the name reported for the embedded manifest.
+const DefaultSource = "embedded:default.yaml"
+
+// Kind is the installation kind of a package.
+type Kind string
+
+const (
+	KindFormula Kind = "formula"
+	KindCask    Kind = "cask"
+	KindMas     Kind = "mas" // Mac App Store app, installed with mas by its ID
+)
+
+// Probe types understood by the manifest.
+const (
+	ProbeFormula = "formula" // brew list <name>
+	ProbeCask    = "cask"    // brew list --cask <name>
+	ProbeApp     = "app"     // an app bundle exists
+	ProbeCommand = "command" // an executable is on PATH
+	ProbeFile    = "file"    // a file or directory exists
+	ProbeShell   = "shell"   // a shell script exits with 0
+)
+
+// How the probes of a package combine.
+const (
+	MatchAny = "any" // any probe detects the package (default)
+	MatchAll = "all" // every probe must detect the package
+)
+
+// Probe is an extra check used to detect an already installed package.
+type Probe struct {
+	Type string `yaml:"type"`
+	Name string `yaml:"name,omitempty"` // formula, cask or command name, defaults to the package name
+	Path string `yaml:"path,omitempty"` // path for app and file probes
+	Run  string `yaml:"run,omitempty"`  // script for shell probes
+
+	Line int `yaml:"-"`
+}
+
+// Check types understood by the manifest.
+const (
+	CheckBinary  = "binary"  // an executable is on PATH
+	CheckVersion = "version" // the output of an executable matches a pattern
+	CheckApp     = "app"     // an app bundle (or any path) exists
+)
+
+// Check verifies that a package was actually installed.
+type Check struct {
+	Type    string   `yaml:"type"`
+	Name    string   `yaml:"name,omitempty"`    // executable name, defaults to the package name
+	Args    []string `yaml:"args,omitempty"`    // arguments of version checks, defaults to --version
+	Pattern string   `yaml:"pattern,omitempty"` // regexp the version output must match
+	Path    string   `yaml:"path,omitempty"`    // path for app checks
+
+	Line int `yaml:"-"`
+}
+
+// Hook failure modes.
+const (
+	HookFatal = "fatal" // a failure fails the run (default)
+	HookWarn  = "warn"  // a failure only prints a warning
+)
+
+// Hook types. Hooks without a type run a shell script.
+const (
+	HookShell    = "shell"    // run the script in run
+	HookWrite    = "write"    // write content to path
+	HookAppend   = "append"   // append content to path unless already there
+	HookSymlink  = "symlink"  // link path to target
+	HookTemplate = "template" // render the Go template in content to path
+	HookDownload = "download" // download url to path checking its sha256
+	HookMkdir    = "mkdir"    // create the directory path
+)
+
+// Hook is a step run before or after the installs: a shell script, or one
+// of the native file operations.
+type Hook struct {
+	Type        string `yaml:"type,omitempty"`        // defaults to shell
+	Description string `yaml:"description,omitempty"` // shown while the hook runs
+	Run         string `yaml:"run,omitempty"`         // script for shell hooks
+	Path        string `yaml:"path,omitempty"`        // file, link or directory; "~/" is the home directory
+	Content     string `yaml:"content,omitempty"`     // for write, append and template hooks
+	Target      string `yaml:"target,omitempty"`      // what a symlink points to
+	URL         string `yaml:"url,omitempty"`         // for download hooks
+	SHA256      string `yaml:"sha256,omitempty"`      // expected checksum of a download
+	Mode        string `yaml:"mode,omitempty"`        // octal permissions, e.g. "0755"
+	OnFailure   string `yaml:"on_failure,omitempty"`  // fatal (default) or warn
+	Privileged  bool   `yaml:"privileged,omitempty"`  // needs sudo; only shell hooks, which can call it
+
+	Line int `yaml:"-"`
+}
+
+// FileMode returns the parsed Mode, or 0 when unset.
+func (h Hook) FileMode() fs.FileMode {
+	mode, _ := strconv.ParseUint(h.Mode, 8, 32)
+	return fs.FileMode(mode)
+}
+
+// Retry overrides the retry policy of a package install.
+type Retry struct {
+	Attempts  int      `yaml:"attempts,omitempty"`   // maximum number of attempts
+	Backoff   string   `yaml:"backoff,omitempty"`    // initial delay, doubled after every attempt (e.g. "2s")
+	ExitCodes []int    `yaml:"exit_codes,omitempty"` // exit codes worth retrying
+	Patterns  []string `yaml:"patterns,omitempty"`   // output regexps worth retrying
+
+	Line int `yaml:"-"`
+}
+
+// Package is a single installable entry of the catalog.
+type Package struct {
+	Name        string  `yaml:"name"`
+	Kind        Kind    `yaml:"kind"`
+	ID          int64   `yaml:"id,omitempty"`      // App Store ID of mas packages
+	Version     string  `yaml:"version,omitempty"` // constraint the installed version must meet (e.g. ">=20 <21")
+	Pin         bool    `yaml:"pin,omitempty"`     // brew pin the formula so brew upgrade leaves it alone
+	Description string  `yaml:"description,omitempty"`
+	Message     string  `yaml:"message,omitempty"` // printed when the package is picked
+	Probes      []Probe `yaml:"probes,omitempty"`
+	Match       string  `yaml:"match,omitempty"`  // how probes combine: any (default) or all
+	Verify      []Check `yaml:"verify,omitempty"` // run after the install
+	Before      []Hook  `yaml:"before,omitempty"` // run before the install
+	After       []Hook  `yaml:"after,omitempty"`  // run after the install
+	Retry       *Retry  `yaml:"retry,omitempty"`
+	Timeout     string  `yaml:"timeout,omitempty"`    // maximum duration of each install attempt (e.g. "20m")
+	Estimate    string  `yaml:"estimate,omitempty"`   // typical install duration, for the ETA until the machine has history (e.g. "45s")
+	Privileged  bool    `yaml:"privileged,omitempty"` // the install needs sudo, e.g. casks with a pkg installer
+	Optional    bool    `yaml:"optional,omitempty"`   // only installed when a picked profile lists it
+
+	Line int `yaml:"-"`
+}
+
+// Profile is a named set of packages for a role, e.g. frontend.
+type Profile struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description,omitempty"`
+	Packages    []string `yaml:"packages"` // names of entries of packages
+
+	Line int `yaml:"-"`
+}
+
+// Catalog is the parsed manifest.
+type Catalog struct {
+	Before   []Hook    `yaml:"before,omitempty"` // run before every other step
+	After    []Hook    `yaml:"after,omitempty"`  // run once every other step is done
+	Packages []Package `yaml:"packages"`
+	Editors  []Package `yaml:"editors"`
+	Profiles []Profile `yaml:"profiles,omitempty"`
+
+	// Source is the file the catalog was read from.
+	Source string `yaml:"-"`
+	// Revision identifies the version of a remote catalog, e.g. its
+	// commit; empty for files and the embedded catalog.
+	Revision string `yaml:"-"`
+	// FetchErr is set when the remote catalog could not be fetched and
+	// the cached or embedded copy is used instead, see LoadRemote.
+	FetchErr error `yaml:"-"`
+
+	editorsLine int // of the editors key, 0 when missing
+}
+
+// Error is a validation error pointing at the offending file and line.
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s", e.File, e.Msg)
+}
+
+// Default returns the catalog embedded in the binary.
+func Default() (*Catalog, error) {
+	return Parse(DefaultSource, defaultManifest)
+}
+
+// Load reads the manifest at path, or the embedded one if path is empty.
+func Load(path string) (*Catalog, error) {
+	if path == "" {
+		return Default()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+	return Parse(path, data)
+}
+
+// Parse decodes and validates a manifest. name is used in error messages.
+func Parse(name string, data []byte) (*Catalog, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, yamlError(name, err)
+	}
+
+	c := &Catalog{Source: name}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return nil, yamlError(name, err)
+	}
+
+	if len(root.Content) > 0 {
+		doc := root.Content[0]
+		assignHookLines(c.Before, sequence(doc, "before"))
+		assignHookLines(c.After, sequence(doc, "after"))
+		assignLines(c.Packages, sequence(doc, "packages"))
+		assignLines(c.Editors, sequence(doc, "editors"))
+		if v := mappingValue(doc, "editors"); v != nil {
+			c.editorsLine = v.Line
+		}
+		for i, node := range sequence(doc, "profiles") {
+			if i < len(c.Profiles) {
+				c.Profiles[i].Line = node.Line
+			}
+		}
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Find returns the package with the given name from packages or editors.
+func (c *Catalog) Find(name string) (Package, bool) {
+	for _, list := range [][]Package{c.Packages, c.Editors} {
+		for _, p := range list {
+			if p.Name == name {
+				return p, true
+			}
+		}
+	}
+	return Package{}, false
+}
+
+// EditorNames returns the names of the editors in manifest order.
+func (c *Catalog) EditorNames() []string {
+	names := make([]string, 0, len(c.Editors))
+	for _, e := range c.Editors {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+// ProfileNames returns the names of the profiles in manifest order.
+func (c *Catalog) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for _, p := range c.Profiles {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// DefaultPackages returns the packages installed when no profile is
+// picked: every package but the optional ones.
+func (c *Catalog) DefaultPackages() []Package {
+	var pkgs []Package
+	for _, p := range c.Packages {
+		if !p.Optional {
+			pkgs = append(pkgs, p)
+		}
+	}
+	return pkgs
+}
+
+// ProfilePackages returns the union of the packages of the named profiles,
+// in manifest order. Unknown names are an error listing the valid ones.
+func (c *Catalog) ProfilePackages(names []string) ([]Package, error) {
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		i := slices.IndexFunc(c.Profiles, func(p Profile) bool { return p.Name == name })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown profile %q (%s)", name, strings.Join(c.ProfileNames(), ", "))
+		}
+		for _, pkg := range c.Profiles[i].Packages {
+			wanted[pkg] = true
+		}
+	}
+	var pkgs []Package
+	for _, p := range c.Packages {
+		if wanted[p.Name] {
+			pkgs = append(pkgs, p)
+		}
+	}
+	return pkgs, nil
+}
+
+// Tap returns the tap of a package named with it, e.g. "homebrew/cask-fonts"
+// for "homebrew/cask-fonts/font-fira-code", or "" for a plain name.
+func (p Package) Tap() string {
+	if p.Kind == KindMas {
+		return ""
+	}
+	i := strings.LastIndex(p.Name, "/")
+	if i < 0 {
+		return ""
+	}
+	return p.Name[:i]
+}
+
+// AppPath returns where a mas package installs its app.
+func (p Package) AppPath() string {
+	return "/Applications/" + p.Name + ".app"
+}
+
+// Constraint returns the parsed Version, zero when unset.
+func (p Package) Constraint() Constraint {
+	c, _ := ParseConstraint(p.Version)
+	return c
+}
+
+// TimeoutDuration returns the parsed Timeout, or 0 when unset.
+func (p Package) TimeoutDuration() time.Duration {
+	d, _ := time.ParseDuration(p.Timeout)
+	return d
+}
+
+// EstimateDuration returns the parsed Estimate, or 0 when unset.
+func (p Package) EstimateDuration() time.Duration {
+	d, _ := time.ParseDuration(p.Estimate)
+	return d
+}
+
+func (c *Catalog) validate() error {
+	if err := c.validateProfiles(); err != nil {
+		return err
+	}
+	if err := c.validateHooks("", "before", c.Before); err != nil {
+		return err
+	}
+	if err := c.validateHooks("", "after", c.After); err != nil {
+		return err
+	}
+	// Setup asks to pick one, so the list cannot be empty.
+	if len(c.Editors) == 0 {
+		return c.errorf(c.editorsLine, "no editors: the manifest needs at least one")
+	}
+	for _, section := range []struct {
+		name string
+		list []Package
+	}{{"packages", c.Packages}, {"editors", c.Editors}} {
+		seen := make(map[string]int)
+		for _, p := range section.list {
+			if err := c.validatePackage(p); err != nil {
+				return err
+			}
+			if line, ok := seen[p.Name]; ok {
+				return c.errorf(p.Line, "duplicate package %q in %s (first declared on line %d)", p.Name, section.name, line)
+			}
+			seen[p.Name] = p.Line
+		}
+	}
+	return nil
+}
+
+func (c *Catalog) validatePackage(p Package) error {
+	if p.Name == "" {
+		return c.errorf(p.Line, "package without name")
+	}
+	switch p.Kind {
+	case KindFormula, KindCask:
+	case KindMas:
+		if p.ID <= 0 {
+			return c.errorf(p.Line, "package %q: mas packages need their App Store id", p.Name)
+		}
+	case "":
+		return c.errorf(p.Line, "package %q: missing kind (formula, cask or mas)", p.Name)
+	default:
+		return c.errorf(p.Line, "package %q: unknown kind %q (formula, cask or mas)", p.Name, p.Kind)
+	}
+	switch p.Match {
+	case "", MatchAny, MatchAll:
+	default:
+		return c.errorf(p.Line, "package %q: unknown match %q (any or all)", p.Name, p.Match)
+	}
+	for _, probe := range p.Probes {
+		switch probe.Type {
+		case ProbeFormula, ProbeCask, ProbeCommand:
+		case ProbeApp, ProbeFile:
+			if probe.Path == "" {
+				return c.errorf(probe.Line, "package %q: %s probe without path", p.Name, probe.Type)
+			}
+		case ProbeShell:
+			if probe.Run == "" {
+				return c.errorf(probe.Line, "package %q: shell probe without run", p.Name)
+			}
+		case "":
+			return c.errorf(probe.Line, "package %q: probe without type", p.Name)
+		default:
+			return c.errorf(probe.Line, "package %q: unknown probe type %q", p.Name, probe.Type)
+		}
+	}
+	for _, check := range p.Verify {
+		switch check.Type {
+		case CheckBinary:
+		case CheckVersion:
+			if check.Pattern == "" {
+				return c.errorf(check.Line, "package %q: version check without pattern", p.Name)
+			}
+			if _, err := regexp.Compile(check.Pattern); err != nil {
+				return c.errorf(check.Line, "package %q: invalid version pattern %q: %v", p.Name, check.Pattern, err)
+			}
+		case CheckApp:
+			if check.Path == "" {
+				return c.errorf(check.Line, "package %q: app check without path", p.Name)
+			}
+		case "":
+			return c.errorf(check.Line, "package %q: check without type", p.Name)
+		default:
+			return c.errorf(check.Line, "package %q: unknown check type %q", p.Name, check.Type)
+		}
+	}
+	if err := c.validateHooks(p.Name, "before", p.Before); err != nil {
+		return err
+	}
+	if err := c.validateHooks(p.Name, "after", p.After); err != nil {
+		return err
+	}
+	if p.Timeout != "" {
+		if d, err := time.ParseDuration(p.Timeout); err != nil || d <= 0 {
+			return c.errorf(p.Line, "package %q: invalid timeout %q", p.Name, p.Timeout)
+		}
+	}
+	if p.Estimate != "" {
+		if d, err := time.ParseDuration(p.Estimate); err != nil || d <= 0 {
+			return c.errorf(p.Line, "package %q: invalid estimate %q", p.Name, p.Estimate)
+		}
+	}
+	if p.Version != "" {
+		if p.Kind == KindMas {
+			return c.errorf(p.Line, "package %q: mas packages have no version to constrain", p.Name)
+		}
+		if _, err := ParseConstraint(p.Version); err != nil {
+			return c.errorf(p.Line, "package %q: %v", p.Name, err)
+		}
+	}
+	if p.Pin && p.Kind != KindFormula {
+		return c.errorf(p.Line, "package %q: only formulae can be pinned", p.Name)
+	}
+	if r := p.Retry; r != nil {
+		if r.Attempts < 0 {
+			return c.errorf(r.Line, "package %q: retry attempts must be positive", p.Name)
+		}
+		if r.Backoff != "" {
+			if d, err := time.ParseDuration(r.Backoff); err != nil || d < 0 {
+				return c.errorf(r.Line, "package %q: invalid retry backoff %q", p.Name, r.Backoff)
+			}
+		}
+		for _, pattern := range r.Patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return c.errorf(r.Line, "package %q: invalid retry pattern %q: %v", p.Name, pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateProfiles checks that profiles have unique names and only refer
+// to entries of packages, and that every optional package is in a profile,
+// since nothing else installs it.
+func (c *Catalog) validateProfiles() error {
+	seen := make(map[string]int)
+	for _, p := range c.Profiles {
+		if p.Name == "" {
+			return c.errorf(p.Line, "profile without name")
+		}
+		if line, ok := seen[p.Name]; ok {
+			return c.errorf(p.Line, "duplicate profile %q (first declared on line %d)", p.Name, line)
+		}
+		seen[p.Name] = p.Line
+		for _, name := range p.Packages {
+			if !slices.ContainsFunc(c.Packages, func(pkg Package) bool { return pkg.Name == name }) {
+				return c.errorf(p.Line, "profile %q: unknown package %q", p.Name, name)
+			}
+		}
+	}
+	for _, pkg := range c.Packages {
+		if pkg.Optional && !slices.ContainsFunc(c.Profiles, func(p Profile) bool { return slices.Contains(p.Packages, pkg.Name) }) {
+			return c.errorf(pkg.Line, "package %q: optional, but no profile lists it", pkg.Name)
+		}
+	}
+	return nil
+}
+
+// validateHooks checks the before or after hooks of pkg, or of the whole run
+// when pkg is empty.
+func (c *Catalog) validateHooks(pkg, when string, hooks []Hook) error {
+	prefix := ""
+	if pkg != "" {
+		prefix = fmt.Sprintf("package %q: ", pkg)
+	}
+	for _, h := range hooks {
+		if problem := validateHook(h); problem != "" {
+			return c.errorf(h.Line, "%s%s hook: %s", prefix, when, problem)
+		}
+		switch h.OnFailure {
+		case "", HookFatal, HookWarn:
+		default:
+			return c.errorf(h.Line, "%s%s hook: unknown on_failure %q (fatal or warn)", prefix, when, h.OnFailure)
+		}
+	}
+	return nil
+}
+
+// sha256Hex matches a hex encoded SHA-256 checksum.
+var sha256Hex = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// validateHook returns what is wrong with h, or "" if nothing is.
+func validateHook(h Hook) string {
+	required := map[string][]string{
+		HookShell:    {"run"},
+		HookWrite:    {"path"},
+		HookAppend:   {"path", "content"},
+		HookSymlink:  {"path", "target"},
+		HookTemplate: {"path", "content"},
+		HookDownload: {"path", "url", "sha256"},
+		HookMkdir:    {"path"},
+	}
+	typ := h.Type
+	if typ == "" {
+		typ = HookShell
+	}
+	fields, ok := required[typ]
+	if !ok {
+		return fmt.Sprintf("unknown type %q", h.Type)
+	}
+	values := map[string]string{
+		"run": h.Run, "path": h.Path, "content": h.Content,
+		"target": h.Target, "url": h.URL, "sha256": h.SHA256,
+	}
+	for _, f := range fields {
+		if values[f] == "" {
+			return fmt.Sprintf("%s hook without %s", typ, f)
+		}
+	}
+	// Native hooks run inside paisanos as the user, so sudo would not
+	// reach them; a shell hook can run `sudo` itself.
+	if h.Privileged && typ != HookShell {
+		return fmt.Sprintf("privileged is only supported on shell hooks, not %s", typ)
+	}
+	if h.SHA256 != "" && !sha256Hex.MatchString(h.SHA256) {
+		return fmt.Sprintf("invalid sha256 %q", h.SHA256)
+	}
+	if h.Mode != "" {
+		if _, err := strconv.ParseUint(h.Mode, 8, 32); err != nil {
+			return fmt.Sprintf("invalid mode %q", h.Mode)
+		}
+	}
+	if typ == HookTemplate {
+		if _, err := template.New(h.Path).Parse(h.Content); err != nil {
+			return fmt.Sprintf("invalid template: %v", err)
+		}
+	}
+	return ""
+}
+
+func (c *Catalog) errorf(line int, format string, args ...any) error {
+	return &Error{File: c.Source, Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// yamlLine matches the "line N: msg" prefix used by yaml.v3 errors.
+var yamlLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// yamlError converts a yaml decoding error into an Error for file name.
+func yamlError(name string, err error) error {
+	msg := err.Error()
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+		msg = typeErr.Errors[0]
+	}
+	if m := yamlLine.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return &Error{File: name, Line: line, Msg: m[2]}
+	}
+	return &Error{File: name, Msg: strings.TrimPrefix(msg, "yaml: ")}
+}
+
+// mappingValue returns the node stored under key in a mapping node.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// sequence returns the items of the sequence stored under key in a mapping node.
+func sequence(mapping *yaml.Node, key string) []*yaml.Node {
+	if v := mappingValue(mapping, key); v != nil && v.Kind == yaml.SequenceNode {
+		return v.Content
+	}
+	return nil
+}
+
+// assignLines records the manifest line of every package, probe, check and
+// hook.
+func assignLines(pkgs []Package, nodes []*yaml.Node) {
+	for i := range pkgs {
+		if i >= len(nodes) {
+			return
+		}
+		pkgs[i].Line = nodes[i].Line
+		if pkgs[i].Retry != nil {
+			if retry := mappingValue(nodes[i], "retry"); retry != nil {
+				pkgs[i].Retry.Line = retry.Line
+			}
+		}
+		probes := sequence(nodes[i], "probes")
+		for j := range pkgs[i].Probes {
+			if j < len(probes) {
+				pkgs[i].Probes[j].Line = probes[j].Line
+			}
+		}
+		assignHookLines(pkgs[i].Before, sequence(nodes[i], "before"))
+		assignHookLines(pkgs[i].After, sequence(nodes[i], "after"))
+		checks := sequence(nodes[i], "verify")
+		for j := range pkgs[i].Verify {
+			if j < len(checks) {
+				pkgs[i].Verify[j].Line = checks[j].Line
+			}
+		}
+	}
+}
+
+// assignHookLines records the manifest line of every hook.
+func assignHookLines(hooks []Hook, nodes []*yaml.Node) {
+	for i := range hooks {
+		if i < len(nodes) {
+			hooks[i].Line = nodes[i].Line
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package catalog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDefault(t *testing.T) {
+	c, err := Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Packages) == 0 || len(c.Editors) == 0 {
+		t.Fatalf("default catalog has %d packages and %d editors", len(c.Packages), len(c.Editors))
+	}
+	for _, list := range [][]Package{c.Packages, c.Editors} {
+		for _, p := range list {
+			if p.Line == 0 {
+				t.Errorf("package %q has no line", p.Name)
+			}
+		}
+	}
+	for _, name := range c.ProfileNames() {
+		if _, err := c.ProfilePackages([]string{name}); err != nil {
+			t.Errorf("profile %q: %v", name, err)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	// Every manifest is valid but for the lines added after this prefix.
+	const prefix = `editors:
+  - name: neovim
+    kind: formula
+packages:
+  - name: git
+    kind: formula
+`
+	tests := []struct {
+		name     string
+		manifest string
+		line     int
+		msg      string
+	}{
+		{
+			name:     "unknown kind",
+			manifest: prefix + "  - name: go\n    kind: binary\n",
+			line:     7,
+			msg:      `package "go": unknown kind "binary"`,
+		},
+		{
+			name:     "duplicate name",
+			manifest: prefix + "  - name: git\n    kind: formula\n",
+			line:     7,
+			msg:      `duplicate package "git" in packages (first declared on line 5)`,
+		},
+		{
+			name:     "unknown field",
+			manifest: prefix + "    versions: \">=2\"\n",
+			line:     7,
+			msg:      "field versions not found",
+		},
+		{
+			name:     "bad probe",
+			manifest: prefix + "    probes:\n      - type: file\n",
+			line:     8,
+			msg:      `package "git": file probe without path`,
+		},
+		{
+			name:     "bad constraint",
+			manifest: prefix + "    version: \">=abc\"\n",
+			line:     5,
+			msg:      `package "git": invalid version "abc"`,
+		},
+		{
+			name:     "privileged native hook",
+			manifest: prefix + "    after:\n      - type: mkdir\n        path: ~/Code\n        privileged: true\n",
+			line:     8,
+			msg:      `package "git": after hook: privileged is only supported on shell hooks, not mkdir`,
+		},
+		{
+			name:     "no editors",
+			manifest: "editors: []\npackages:\n  - name: git\n    kind: formula\n",
+			line:     1,
+			msg:      "no editors",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("catalog.yaml", []byte(tt.manifest))
+			var catErr *Error
+			if !errors.As(err, &catErr) {
+				t.Fatalf("Parse error = %v, want *Error", err)
+			}
+			if catErr.File != "catalog.yaml" || catErr.Line != tt.line || !strings.Contains(catErr.Msg, tt.msg) {
+				t.Errorf("Parse error = %v, want catalog.yaml:%d: %s", catErr, tt.line, tt.msg)
+			}
+		})
+	}
+}
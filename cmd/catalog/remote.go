@@ -0,0 +1,358 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"paisanos-cli/cmd/executor"
+)
+
+// DefaultRemotePath is the manifest read from a git remote whose source
+// does not name one after a "#".
+const DefaultRemotePath = "catalog.yaml"
+
+// fetchTimeout bounds the whole download of a remote catalog, so a slow
+// network falls back to the cache instead of stalling the setup.
+const fetchTimeout = 20 * time.Second
+
+// maxRemoteSize caps the size of a remote manifest.
+const maxRemoteSize = 4 << 20
+
+// httpClient fetches remote catalogs.
+var httpClient = &http.Client{}
+
+// cacheMeta records what the cached copy of a remote catalog is.
+type cacheMeta struct {
+	Source    string    `json:"source"`
+	ETag      string    `json:"etag,omitempty"`   // HTTPS catalogs
+	Commit    string    `json:"commit,omitempty"` // git catalogs
+	Revision  string    `json:"revision"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// LoadRemote fetches the catalog at source: an HTTPS URL, or a git remote
+// optionally followed by "#path/in/repo.yaml" (DefaultRemotePath when
+// omitted). Git remotes are recognized by a git@, ssh://, git:// or git+
+// prefix, or a .git suffix.
+//
+// Every remote manifest comes with a detached signature next to it (see
+// SignatureSuffix), verified before the manifest is even parsed; a missing
+// or mismatching one is a *SignatureError.
+//
+// The last fetched copy is cached, so unchanged catalogs are not
+// downloaded again (by ETag or by commit). When the remote is unreachable
+// the cached copy, verified again, or else the embedded one is returned
+// with FetchErr set. A remote catalog that fails validation is an error.
+func LoadRemote(ctx context.Context, ex executor.Executor, source string) (*Catalog, error) {
+	dir, err := cacheDir(source)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	var c *Catalog
+	if IsGitRemote(source) {
+		c, err = loadGit(ctx, ex, source, dir)
+	} else {
+		c, err = loadHTTP(ctx, source, dir)
+	}
+	var fe *fetchError
+	if !errors.As(err, &fe) {
+		return c, err
+	}
+	return loadFallback(source, dir, fe.err)
+}
+
+// IsGitRemote reports whether source names a git remote rather than an
+// HTTPS URL.
+func IsGitRemote(source string) bool {
+	remote, _, _ := strings.Cut(source, "#")
+	for _, prefix := range []string{"git@", "ssh://", "git://", "git+"} {
+		if strings.HasPrefix(remote, prefix) {
+			return true
+		}
+	}
+	return strings.HasSuffix(remote, ".git")
+}
+
+// fetchError is a failure to reach the remote, as opposed to a broken
+// catalog, so the cached copy can stand in.
+type fetchError struct{ err error }
+
+func (e *fetchError) Error() string { return e.err.Error() }
+
+// loadHTTP downloads the manifest at url, sending the ETag of the cached
+// copy so an unchanged catalog is not downloaded again.
+func loadHTTP(ctx context.Context, url, dir string) (*Catalog, error) {
+	if !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("catalog %s: only https:// URLs and git remotes are supported", url)
+	}
+	meta, cached, cachedSig := readCache(dir)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if meta.ETag != "" && cached != nil {
+		req.Header.Set("If-None-Match", meta.ETag)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &fetchError{err}
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if cached == nil {
+			return nil, &fetchError{fmt.Errorf("GET %s: %s without a cached copy", url, resp.Status)}
+		}
+		return parseRemote(url, cached, cachedSig, meta.Revision)
+	case http.StatusOK:
+	default:
+		return nil, &fetchError{fmt.Errorf("GET %s: %s", url, resp.Status)}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteSize+1))
+	if err != nil {
+		return nil, &fetchError{err}
+	}
+	if len(data) > maxRemoteSize {
+		return nil, fmt.Errorf("catalog %s is larger than %d bytes", url, maxRemoteSize)
+	}
+	sig, err := fetchSignature(ctx, url+SignatureSuffix)
+	if err != nil {
+		return nil, err
+	}
+	meta = cacheMeta{Source: url, ETag: resp.Header.Get("ETag"), FetchedAt: time.Now()}
+	meta.Revision = "sha256 " + contentHash(data)
+	if meta.ETag != "" {
+		meta.Revision = "ETag " + meta.ETag
+	}
+	c, err := parseRemote(url, data, sig, meta.Revision)
+	if err != nil {
+		return nil, err
+	}
+	// A failing cache only costs a download next time.
+	_ = writeCache(dir, meta, data, sig)
+	return c, nil
+}
+
+// fetchSignature downloads the detached signature at url. A missing one
+// yields nil, which Verify refuses.
+func fetchSignature(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, &fetchError{err}
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, &fetchError{fmt.Errorf("GET %s: %s", url, resp.Status)}
+	}
+	sig, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return nil, &fetchError{err}
+	}
+	return sig, nil
+}
+
+// loadGit reads the manifest from a shallow clone of the remote, cloned
+// again only when the commit of its HEAD changed.
+func loadGit(ctx context.Context, ex executor.Executor, source, dir string) (*Catalog, error) {
+	remote, path, _ := strings.Cut(source, "#")
+	remote = strings.TrimPrefix(remote, "git+")
+	// remote goes after "--" below, so a value like "--upload-pack=..." is
+	// never read as an option.
+	if path == "" {
+		path = DefaultRemotePath
+	}
+
+	out, err := git(ctx, ex, "ls-remote", "--", remote, "HEAD")
+	if err != nil {
+		return nil, &fetchError{err}
+	}
+	commit, _, _ := strings.Cut(strings.TrimSpace(out), "\t")
+	if commit == "" {
+		return nil, &fetchError{fmt.Errorf("git ls-remote %s: HEAD not found", remote)}
+	}
+
+	meta, _, _ := readCache(dir)
+	repo := filepath.Join(dir, "repo")
+	if meta.Commit != commit || !ex.Exists(filepath.Join(repo, path)) {
+		// Clone next to the cached copy and swap it in once the catalog
+		// validates, so a broken push never replaces a good cache.
+		tmp := repo + ".new"
+		_ = os.RemoveAll(tmp)
+		if _, err := git(ctx, ex, "clone", "--depth", "1", "--quiet", "--", remote, tmp); err != nil {
+			_ = os.RemoveAll(tmp)
+			return nil, &fetchError{err}
+		}
+		head, err := git(ctx, ex, "-C", tmp, "rev-parse", "HEAD")
+		if err != nil {
+			_ = os.RemoveAll(tmp)
+			return nil, &fetchError{err}
+		}
+		meta = cacheMeta{Source: source, Commit: strings.TrimSpace(head), FetchedAt: time.Now()}
+		meta.Revision = "commit " + shortCommit(meta.Commit)
+		if _, err := readRepoFile(tmp, path, source, meta.Revision); err != nil {
+			_ = os.RemoveAll(tmp)
+			return nil, err
+		}
+		if err := os.RemoveAll(repo); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(tmp, repo); err != nil {
+			return nil, err
+		}
+		_ = writeCache(dir, meta, nil, nil)
+	}
+	return readRepoFile(repo, path, source, meta.Revision)
+}
+
+// loadFallback returns the cached copy of the catalog at source, or the
+// embedded one, recording why the remote was not used.
+func loadFallback(source, dir string, fetchErr error) (*Catalog, error) {
+	meta, data, sig := readCache(dir)
+	if IsGitRemote(source) {
+		_, path, _ := strings.Cut(source, "#")
+		if path == "" {
+			path = DefaultRemotePath
+		}
+		data, _ = os.ReadFile(filepath.Join(dir, "repo", path))
+		sig, _ = os.ReadFile(filepath.Join(dir, "repo", path+SignatureSuffix))
+	}
+	var c *Catalog
+	var err error
+	if data != nil {
+		revision := "caché"
+		if meta.Revision != "" {
+			revision = meta.Revision + " (caché)"
+		}
+		c, err = parseRemote(source, data, sig, revision)
+	} else {
+		c, err = Default()
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.FetchErr = fetchErr
+	return c, nil
+}
+
+func readRepoFile(repo, path, source, revision string) (*Catalog, error) {
+	data, err := os.ReadFile(filepath.Join(repo, path))
+	if err != nil {
+		return nil, fmt.Errorf("catalog %s: %w", source, err)
+	}
+	// A missing signature is refused by Verify.
+	sig, _ := os.ReadFile(filepath.Join(repo, path+SignatureSuffix))
+	return parseRemote(source, data, sig, revision)
+}
+
+// parseRemote verifies the signature of a remote manifest and parses it.
+func parseRemote(source string, data, sig []byte, revision string) (*Catalog, error) {
+	if err := Verify(source, data, sig); err != nil {
+		return nil, err
+	}
+	c, err := Parse(source, data)
+	if err != nil {
+		return nil, err
+	}
+	c.Revision = revision
+	return c, nil
+}
+
+// git runs a git command and returns its output.
+func git(ctx context.Context, ex executor.Executor, args ...string) (string, error) {
+	var out bytes.Buffer
+	cmd := executor.Command{Name: "git", Args: args, Env: []string{"GIT_TERMINAL_PROMPT=0"}}
+	if err := ex.Run(ctx, cmd, &out); err != nil {
+		return "", fmt.Errorf("%s: %w: %s", cmd, err, strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil
+}
+
+// cacheDir returns the cache directory of the catalog at source.
+func cacheDir(source string) (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("resolving cache directory: %w", err)
+	}
+	return filepath.Join(base, "paisanos", "catalogs", contentHash([]byte(source))), nil
+}
+
+// readCache returns the metadata and, for HTTPS catalogs, the manifest and
+// signature of the cached copy in dir. Missing files yield zero values.
+func readCache(dir string) (cacheMeta, []byte, []byte) {
+	var meta cacheMeta
+	if data, err := os.ReadFile(filepath.Join(dir, "meta.json")); err == nil {
+		_ = json.Unmarshal(data, &meta)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "catalog.yaml"))
+	if err != nil {
+		return meta, nil, nil
+	}
+	sig, _ := os.ReadFile(filepath.Join(dir, "catalog.yaml"+SignatureSuffix))
+	return meta, data, sig
+}
+
+// writeCache stores meta and, unless nil, the manifest and its signature
+// in dir.
+func writeCache(dir string, meta cacheMeta, data, sig []byte) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if data != nil {
+		if err := writeAtomic(filepath.Join(dir, "catalog.yaml"), data); err != nil {
+			return err
+		}
+		if err := writeAtomic(filepath.Join(dir, "catalog.yaml"+SignatureSuffix), sig); err != nil {
+			return err
+		}
+	}
+	m, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeAtomic(filepath.Join(dir, "meta.json"), m)
+}
+
+func writeAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// contentHash returns a short hex SHA-256 of data.
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
@@ -0,0 +1,104 @@
+package catalog
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	_ "embed"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SignatureSuffix is appended to the location of a remote manifest to find
+// its detached signature, e.g. catalog.yaml.sig.
+const SignatureSuffix = ".sig"
+
+// publicKeyPEM is the key remote catalogs must be signed with.
+//
+//go:embed catalog.pub
+var publicKeyPEM []byte
+
+// Reasons of a SignatureError.
+var (
+	ErrNoPublicKey        = errors.New("no public key in catalog.pub")
+	ErrMissingSignature   = errors.New("missing signature")
+	ErrMalformedSignature = errors.New("malformed signature")
+	ErrSignatureMismatch  = errors.New("signature does not match")
+)
+
+// SignatureError means a remote catalog is unsigned or its signature does
+// not match the compiled-in public key, so it must not be used.
+type SignatureError struct {
+	Source string
+	Err    error
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("catalog %s: %v", e.Source, e.Err)
+}
+
+func (e *SignatureError) Unwrap() error { return e.Err }
+
+// PublicKey returns the compiled-in key that verifies remote catalogs.
+func PublicKey() (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(publicKeyPEM)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, ErrNoPublicKey
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("catalog.pub: %w", err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("catalog.pub: %T is not an ed25519 key", key)
+	}
+	return pub, nil
+}
+
+// ParsePrivateKey decodes a PEM encoded ed25519 private key, as written by
+// `openssl genpkey -algorithm ed25519`.
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("no PEM private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%T is not an ed25519 key", key)
+	}
+	return priv, nil
+}
+
+// Sign returns the detached signature of a manifest: the base64 encoded
+// ed25519 signature of its exact bytes.
+func Sign(key ed25519.PrivateKey, manifest []byte) []byte {
+	sig := ed25519.Sign(key, manifest)
+	return []byte(base64.StdEncoding.EncodeToString(sig) + "\n")
+}
+
+// Verify checks the detached signature of the manifest read from source
+// against the compiled-in public key. Failures are *SignatureError.
+func Verify(source string, manifest, signature []byte) error {
+	pub, err := PublicKey()
+	if err != nil {
+		return &SignatureError{Source: source, Err: err}
+	}
+	if len(signature) == 0 {
+		return &SignatureError{Source: source, Err: ErrMissingSignature}
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return &SignatureError{Source: source, Err: ErrMalformedSignature}
+	}
+	if !ed25519.Verify(pub, manifest, sig) {
+		return &SignatureError{Source: source, Err: ErrSignatureMismatch}
+	}
+	return nil
+}
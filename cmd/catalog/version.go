@@ -0,0 +1,158 @@
+package catalog
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Operators of a version constraint term. A term without operator matches
+// the versions starting with it, e.g. "20" matches 20.11.1 but not 21.0.0.
+var constraintOps = []string{">=", "<=", ">", "<", "="}
+
+// opSpaceRe matches the spaces after an operator, as in ">= 20".
+var opSpaceRe = regexp.MustCompile(`(>=|<=|>|<|=)\s+`)
+
+// Constraint is the version a package must have, e.g. ">=20 <21", "20" or
+// "=1.38.0". Every term must hold. It is parsed from Package.Version.
+type Constraint struct {
+	raw   string
+	terms []constraintTerm
+}
+
+type constraintTerm struct {
+	op      string // "" is a prefix match
+	version string
+}
+
+// ParseConstraint parses a version constraint: terms separated by spaces or
+// commas, each an operator (>=, >, <=, <, =) followed by a version, or a
+// bare version prefix.
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{raw: strings.TrimSpace(s)}
+	s = opSpaceRe.ReplaceAllString(s, "$1")
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		t := constraintTerm{version: field}
+		for _, op := range constraintOps {
+			if rest, ok := strings.CutPrefix(field, op); ok {
+				t = constraintTerm{op: op, version: strings.TrimSpace(rest)}
+				break
+			}
+		}
+		if !isVersion(t.version) {
+			return Constraint{}, fmt.Errorf("invalid version %q in constraint %q", t.version, c.raw)
+		}
+		c.terms = append(c.terms, t)
+	}
+	if len(c.terms) == 0 {
+		return Constraint{}, fmt.Errorf("empty version constraint")
+	}
+	return c, nil
+}
+
+// String returns the constraint as written in the manifest.
+func (c Constraint) String() string { return c.raw }
+
+// IsZero reports whether c constrains nothing.
+func (c Constraint) IsZero() bool { return len(c.terms) == 0 }
+
+// Versions returns the versions named by the terms of c.
+func (c Constraint) Versions() []string {
+	vs := make([]string, len(c.terms))
+	for i, t := range c.terms {
+		vs[i] = t.version
+	}
+	return vs
+}
+
+// Check reports whether version satisfies c and, when it does not, whether
+// it is older than c allows, so upgrading the package may fix it. Versions
+// that cannot be compared, like the "latest" of some casks, satisfy every
+// constraint.
+func (c Constraint) Check(version string) (ok, older bool) {
+	if !isVersion(version) {
+		return true, false
+	}
+	ok, older = true, true
+	for _, t := range c.terms {
+		cmp := CompareVersions(version, t.version)
+		var holds bool
+		switch t.op {
+		case ">=":
+			holds = cmp >= 0
+		case ">":
+			holds = cmp > 0
+		case "<=":
+			holds = cmp <= 0
+		case "<":
+			holds = cmp < 0
+		case "=":
+			holds = cmp == 0
+		default:
+			cmp = CompareVersions(truncateVersion(version, len(versionParts(t.version))), t.version)
+			holds = cmp == 0
+		}
+		if !holds {
+			// Only a version below the term can be fixed by upgrading;
+			// for ">" that includes the version itself.
+			ok = false
+			older = older && (cmp < 0 || t.op == ">" && cmp == 0)
+		}
+	}
+	return ok, !ok && older
+}
+
+// CompareVersions compares two Homebrew versions component by component,
+// numerically where both components are numbers, and returns -1, 0 or 1.
+// Revisions ("_1") and cask build suffixes (",abc") are ignored, and
+// missing components count as 0, so 20 equals 20.0.0.
+func CompareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := range max(len(pa), len(pb)) {
+		x, y := "0", "0"
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		nx, errx := strconv.Atoi(x)
+		ny, erry := strconv.Atoi(y)
+		switch {
+		case errx == nil && erry == nil:
+			if nx != ny {
+				if nx < ny {
+					return -1
+				}
+				return 1
+			}
+		case x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionParts splits a version into its components, dropping the
+// Homebrew revision and cask build suffix.
+func versionParts(v string) []string {
+	v, _, _ = strings.Cut(v, ",")
+	v, _, _ = strings.Cut(v, "_")
+	return strings.Split(v, ".")
+}
+
+// truncateVersion keeps the first n components of v.
+func truncateVersion(v string, n int) string {
+	parts := versionParts(v)
+	return strings.Join(parts[:min(n, len(parts))], ".")
+}
+
+// isVersion reports whether v looks like a version, i.e. starts with a
+// digit.
+func isVersion(v string) bool {
+	return v != "" && v[0] >= '0' && v[0] <= '9'
+}
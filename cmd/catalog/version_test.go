@@ -0,0 +1,118 @@
+package catalog
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseConstraint(t *testing.T) {
+	tests := []struct {
+		in       string
+		str      string
+		versions []string
+		wantErr  bool
+	}{
+		{in: ">=20 <21", str: ">=20 <21", versions: []string{"20", "21"}},
+		{in: " >= 20, < 21 ", str: ">= 20, < 21", versions: []string{"20", "21"}},
+		{in: "20", str: "20", versions: []string{"20"}},
+		{in: "=1.38.0", str: "=1.38.0", versions: []string{"1.38.0"}},
+		{in: "", wantErr: true},
+		{in: " , ", wantErr: true},
+		{in: ">=", wantErr: true},
+		{in: ">=abc", wantErr: true},
+		{in: "~1.2", wantErr: true},
+		{in: "20 latest", wantErr: true},
+	}
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseConstraint(%q) = %v, want error", tt.in, c)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseConstraint(%q): %v", tt.in, err)
+			continue
+		}
+		if c.String() != tt.str || !slices.Equal(c.Versions(), tt.versions) {
+			t.Errorf("ParseConstraint(%q) = %q %q, want %q %q", tt.in, c, c.Versions(), tt.str, tt.versions)
+		}
+	}
+}
+
+func TestConstraintCheck(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		ok, older  bool
+	}{
+		// Ranges.
+		{">=20 <21", "20.11.1", true, false},
+		{">=20 <21", "20", true, false},
+		{">=20 <21", "19.9.0", false, true},
+		{">=20 <21", "21.0.0", false, false},
+		{">1.2", "1.2.0", false, true},
+		{">1.2", "1.2.1", true, false},
+		{"<=1.2", "1.2", true, false},
+		{"<=1.2", "1.2.1", false, false},
+		{"<2 >3", "2.5", false, false},
+		{"=1.38.0", "1.38", true, false},
+		{"=1.38.0", "1.38.1", false, false},
+		{"=1.38.0", "1.37.9", false, true},
+		// Prefixes.
+		{"20", "20.11.1", true, false},
+		{"20", "21.1", false, false},
+		{"20", "19.0", false, true},
+		{"20.11", "20.11.3", true, false},
+		{"20.1", "20.11.3", false, false},
+		{"1.10", "1.9.9", false, true},
+		// Homebrew revisions.
+		{"=1.38.0", "1.38.0_1", true, false},
+		{"<1.38.1", "1.38.0_2", true, false},
+		{"20", "20.11.1_3", true, false},
+		// Cask build suffixes.
+		{">=3.2", "3.2.0,abc123", true, false},
+		{"<3.2", "3.2,1234", false, false},
+		{"3", "3.9.1,20240101", true, false},
+		// Versions that cannot be compared satisfy every constraint.
+		{">=1", "latest", true, false},
+		{"=2.0", "", true, false},
+	}
+	for _, tt := range tests {
+		c, err := ParseConstraint(tt.constraint)
+		if err != nil {
+			t.Fatalf("ParseConstraint(%q): %v", tt.constraint, err)
+		}
+		ok, older := c.Check(tt.version)
+		if ok != tt.ok || older != tt.older {
+			t.Errorf("%q.Check(%q) = %v, %v, want %v, %v", tt.constraint, tt.version, ok, older, tt.ok, tt.older)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2.3", "1.2.4", -1},
+		{"1.10", "1.9", 1},
+		{"2", "10", -1},
+		{"20", "20.0.0", 0},
+		{"20.0.1", "20", 1},
+		{"1.2.3_1", "1.2.3", 0},
+		{"1.2_1", "1.2_2", 0},
+		{"4.5,123", "4.5,456", 0},
+		{"4.5,123", "4.6", -1},
+		{"1.2.a", "1.2.b", -1},
+		{"1.2.b", "1.2.10", 1},
+		{"2024.01", "2024.1", 0},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,675 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"paisanos-cli/cmd/catalog"
+	"paisanos-cli/cmd/executor"
+	"paisanos-cli/cmd/runlog"
+	"paisanos-cli/cmd/state"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// defaultJobs is the default number of steps running at once.
+const defaultJobs = 4
+
+type step struct {
+	id          string          // Stable identifier, e.g. "cask:slack".
+	description string          // A description of the step.
+	action      executor.Action // Native operation run instead of command.
+	command     string          // The command to execute.
+	args        []string        // Arguments for the command.
+	env         []string        // Extra environment variables (KEY=value).
+	pkg         string          // Catalog package installed by the step, if any.
+	kind        catalog.Kind    // Kind of pkg.
+	version     string          // Constraint the installed pkg must meet, see catalog.Package.Version.
+	upgrade     bool            // Upgrades pkg instead of installing it.
+	brewPath    bool            // Runs after this run installed Homebrew, so brewBinDirs go first in PATH.
+	deps        []string        // IDs of the steps that must finish first.
+	retry       retryPolicy
+	timeout     time.Duration   // Maximum duration of each attempt, 0 means none.
+	estimate    time.Duration   // Expected duration before the machine has history, 0 means a default.
+	verify      []catalog.Check // Checks run after a successful attempt.
+	warn        bool            // A failure only warns and does not block dependents.
+	privileged  bool            // Needs sudo, see acquireSudo.
+}
+
+// stepStatus is the execution state of a step.
+type stepStatus int
+
+const (
+	statusPending stepStatus = iota
+	statusRunning
+	statusDone
+	statusFailed
+	statusSkipped   // a dependency failed, so the step never ran
+	statusCancelled // the step was killed by an abort
+	statusWarned    // the step failed but only warns, so it counts as done
+)
+
+// abortMode tells how an abort proceeds.
+type abortMode int
+
+const (
+	abortNone         abortMode = iota
+	abortAfterCurrent           // let the running steps finish, start no new ones
+	abortNow                    // kill the running steps
+)
+
+// commandResultMsg is the message returned when a command completes.
+type commandResultMsg struct {
+	stepIndex  int
+	attempt    int
+	exitCode   int
+	output     []byte
+	startedAt  time.Time
+	finishedAt time.Time
+	cancelled  bool
+	err        error
+}
+
+// interruptMsg is sent to plain runs on SIGINT or SIGTERM.
+type interruptMsg struct{}
+
+// retryStepMsg asks the model to run a step again after its backoff.
+type retryStepMsg struct {
+	stepIndex int
+	attempt   int
+}
+
+// engineOptions configures a setupModel.
+type engineOptions struct {
+	jobs      int               // maximum number of steps running at once
+	state     *state.State      // records finished steps; nil disables it
+	keepGoing bool              // keep running after a failure
+	exec      executor.Executor // runs the steps; nil means the real system
+	log       *runlog.Log       // receives every attempt; nil disables it
+	history   *state.History    // estimates the steps and learns their durations; nil disables it
+	// plain receives line-oriented progress instead of the spinner view,
+	// for runs without a terminal; nil means the TUI.
+	plain io.Writer
+}
+
+// setupModel is the Bubble Tea model that runs our setup steps. Steps whose
+// dependencies are done run concurrently, up to jobs at a time.
+type setupModel struct {
+	spinner  spinner.Model
+	steps    []step
+	status   []stepStatus
+	attempt  []int          // current attempt of each step, starting at 1
+	started  []time.Time    // when each step started its first attempt
+	ended    []time.Time    // when each step reached its final status
+	exitCode []int          // exit code of the last attempt of each step
+	caveats  []string       // notes Homebrew printed while installing each step
+	index    map[string]int // step ID -> position in steps
+	jobs     int
+	errs     []error  // failure of each step, if any
+	outputs  [][]byte // full output of each failed step
+	running  int
+	state    *state.State // records finished steps; nil disables it
+	exec     executor.Executor
+	log      *runlog.Log
+	plain    io.Writer
+
+	// keepGoing records failures and keeps running the steps that do not
+	// depend on the failed ones, instead of quitting on the first error.
+	keepGoing bool
+
+	// Output streamed by the running steps, shown in a toggleable pane.
+	lines      chan outputLineMsg
+	tails      []tailBuffer
+	output     viewport.Model
+	showOutput bool
+
+	// Overall progress, weighted by how long each step is expected to take.
+	bar       progress.Model
+	estimates []time.Duration
+	begin     time.Time
+	history   *state.History
+
+	// ctx is cancelled to kill every running step.
+	ctx    context.Context
+	cancel context.CancelFunc
+	abort  abortMode
+	// confirmAbort shows the Ctrl+C prompt; userAborted is set once the
+	// user picks an abort option.
+	confirmAbort bool
+	userAborted  bool
+
+	done bool
+	err  error
+}
+
+// Init starts the spinner and executes the first ready steps.
+func (m *setupModel) Init() tea.Cmd {
+	if len(m.steps) == 0 {
+		m.done = true
+
+		return nil
+	}
+	m.begin = time.Now()
+	return tea.Batch(m.spinner.Tick, waitForOutput(m.lines), m.schedule())
+}
+
+// Update handles messages (spinner ticks and command results).
+func (m *setupModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	// If the setup is done, ignore further messages and quit.
+	if m.done {
+		return m, tea.Quit
+	}
+
+	var cmds []tea.Cmd
+	var cmd tea.Cmd
+
+	switch msg := msg.(type) {
+	case spinner.TickMsg:
+		m.spinner, cmd = m.spinner.Update(msg)
+		cmds = append(cmds, cmd)
+
+	case tea.WindowSizeMsg:
+		m.output.Width = msg.Width
+		m.bar.Width = min(msg.Width-30, maxBarWidth)
+
+	case tea.KeyMsg:
+		switch {
+		case m.confirmAbort:
+			switch msg.String() {
+			case "a":
+				m.confirmAbort = false
+				m.userAborted = true
+				m.abort = abortAfterCurrent
+			case "n", "ctrl+c":
+				m.confirmAbort = false
+				m.userAborted = true
+				m.abortNow()
+			case "esc", "c":
+				m.confirmAbort = false
+			}
+			if m.abort != abortNone && m.running == 0 {
+				m.done = true
+				return m, tea.Quit
+			}
+		case msg.String() == "ctrl+c":
+			if m.abort == abortNone {
+				m.confirmAbort = true
+			}
+		case msg.String() == "o":
+			m.showOutput = !m.showOutput
+			m.refreshOutput()
+		case m.showOutput:
+			m.output, cmd = m.output.Update(msg)
+			cmds = append(cmds, cmd)
+		}
+
+	case interruptMsg:
+		// Plain runs get no keys, so SIGINT aborts right away.
+		if m.abort == abortNone {
+			m.userAborted = true
+			m.abortNow()
+			m.println(skipped("Abortando..."))
+		}
+		if m.running == 0 {
+			m.done = true
+			return m, tea.Quit
+		}
+
+	case outputLineMsg:
+		m.tails[msg.stepIndex].add(msg.line)
+		m.refreshOutput()
+		cmds = append(cmds, waitForOutput(m.lines))
+
+	case retryStepMsg:
+		if m.abort != abortNone {
+			// The step was waiting for its backoff; do not start it again.
+			return m.Update(commandResultMsg{
+				stepIndex:  msg.stepIndex,
+				attempt:    msg.attempt - 1,
+				exitCode:   -1,
+				startedAt:  time.Now(),
+				finishedAt: time.Now(),
+				cancelled:  true,
+				err:        fmt.Errorf("%q cancelado", m.steps[msg.stepIndex].description),
+			})
+		}
+		m.attempt[msg.stepIndex] = msg.attempt
+		m.tails[msg.stepIndex].add(fmt.Sprintf("--- intento %d ---", msg.attempt))
+		if m.plain != nil {
+			s := m.steps[msg.stepIndex]
+			m.println(fmt.Sprintf("↻ %s (intento %d/%d)", s.description, msg.attempt, s.retry.attempts()))
+		}
+		cmds = append(cmds, m.runCommand(msg.stepIndex, msg.attempt))
+
+	case commandResultMsg:
+		s := m.steps[msg.stepIndex]
+		if msg.err != nil && !msg.cancelled && m.abort == abortNone &&
+			s.retry.shouldRetry(msg.attempt, msg.exitCode, msg.output) {
+			m.logAttempt(msg, runlog.StepRetrying)
+			next := retryStepMsg{stepIndex: msg.stepIndex, attempt: msg.attempt + 1}
+			return m, waitBackoff(m.ctx, s.retry.delay(msg.attempt), next)
+		}
+		m.running--
+		m.ended[msg.stepIndex] = msg.finishedAt
+		m.exitCode[msg.stepIndex] = msg.exitCode
+		cmds = append(cmds, m.record(msg))
+		switch {
+		case msg.cancelled:
+			m.logAttempt(msg, runlog.StepCancelled)
+			m.status[msg.stepIndex] = statusCancelled
+			m.errs[msg.stepIndex] = msg.err
+			cmds = append(cmds, m.println(cancelledStep(s.name())))
+		case msg.err != nil && s.warn:
+			m.logAttempt(msg, runlog.StepWarned)
+			m.status[msg.stepIndex] = statusWarned
+			m.errs[msg.stepIndex] = msg.err
+			m.outputs[msg.stepIndex] = msg.output
+			cmds = append(cmds, m.println(warnedStep(s.name())))
+		case msg.err != nil:
+			m.logAttempt(msg, runlog.StepFailed)
+			m.status[msg.stepIndex] = statusFailed
+			m.errs[msg.stepIndex] = msg.err
+			m.outputs[msg.stepIndex] = msg.output
+			cmds = append(cmds, m.println(failedStep(s.name())))
+			if !m.keepGoing && m.err == nil {
+				// Fail fast: kill the other running steps and wait for them.
+				m.err = msg.err
+				m.abortNow()
+			}
+		default:
+			m.logAttempt(msg, runlog.StepDone)
+			m.status[msg.stepIndex] = statusDone
+			m.caveats[msg.stepIndex] = brewCaveats(msg.output)
+			if m.history != nil {
+				m.history.Observe(s.id, msg.finishedAt.Sub(msg.startedAt))
+			}
+			// Print success message if appropriate.
+			switch {
+			case s.upgrade:
+				cmds = append(cmds, m.println(successfullyUpgraded(s.pkg)))
+			case s.pkg != "":
+				cmds = append(cmds, m.println(successfullyInstalled(s.pkg)))
+			case m.plain != nil:
+				m.println(installed("✔  " + s.description))
+			}
+		}
+		if m.finished() || (m.abort != abortNone && m.running == 0) {
+			m.done = true
+			m.cancel()
+			return m, tea.Sequence(tea.Batch(cmds...), tea.Quit)
+		}
+		cmds = append(cmds, m.schedule())
+	}
+
+	return m, tea.Batch(cmds...)
+}
+
+// waitBackoff returns a Tea command that sends next after the delay d, or
+// as soon as ctx is cancelled, so aborting never waits for a backoff.
+func waitBackoff(ctx context.Context, d time.Duration, next retryStepMsg) tea.Cmd {
+	return func() tea.Msg {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+		}
+		return next
+	}
+}
+
+// View renders the overall progress and one spinner line per running step.
+func (m *setupModel) View() string {
+	if m.err != nil {
+		return fmt.Sprintf("\n%s\n", textStyle(fmt.Sprintf("Error: %v", m.err)))
+	}
+	if m.done {
+		return textStyle("\n" + m.outcome() + "\n")
+	}
+	var b strings.Builder
+	b.WriteString("\n" + m.progressView() + "\n")
+	for i, s := range m.steps {
+		if m.status[i] != statusRunning {
+			continue
+		}
+		desc := textStyle(s.description)
+		if s.pkg != "" {
+			desc = installing(s.description)
+		}
+		if m.attempt[i] > 1 {
+			desc += helpStyle(fmt.Sprintf(" (intento %d/%d)", m.attempt[i], s.retry.attempts()))
+		}
+		fmt.Fprintf(&b, "%s %s\n", m.spinner.View(), desc)
+	}
+	switch {
+	case m.confirmAbort:
+		b.WriteString("\n" + textStyle("¿Abortar el setup?") + "\n")
+		b.WriteString(helpStyle("  a: abortar al terminar los pasos en curso") + "\n")
+		b.WriteString(helpStyle("  n: abortar ahora (mata los procesos en curso)") + "\n")
+		b.WriteString(helpStyle("  esc: continuar") + "\n")
+		return b.String()
+	case m.abort == abortAfterCurrent:
+		b.WriteString("\n" + textStyle("Abortando al terminar los pasos en curso...") + "\n")
+	case m.abort == abortNow:
+		b.WriteString("\n" + textStyle("Abortando...") + "\n")
+	}
+	if m.showOutput {
+		b.WriteString("\n" + m.output.View() + "\n")
+		b.WriteString(helpStyle("o: ocultar salida • ↑/↓: desplazar") + "\n")
+	} else {
+		b.WriteString(helpStyle("\no: ver salida • ctrl+c: abortar") + "\n")
+	}
+	return b.String()
+}
+
+// outcome returns the final message of a finished run.
+func (m *setupModel) outcome() string {
+	switch {
+	case m.userAborted:
+		return "Setup interrumpido."
+	case m.failed():
+		return "Tu setup terminó con errores."
+	}
+	return "Tu setup se ha completado correctamente 🚀"
+}
+
+// refreshOutput renders the tail of every running step into the output
+// pane and scrolls it to the bottom.
+func (m *setupModel) refreshOutput() {
+	if !m.showOutput {
+		return
+	}
+	var b strings.Builder
+	for i, s := range m.steps {
+		if m.status[i] != statusRunning {
+			continue
+		}
+		b.WriteString(helpStyle("── "+s.description) + "\n")
+		for _, line := range m.tails[i].lines {
+			b.WriteString(line + "\n")
+		}
+	}
+	atBottom := m.output.AtBottom()
+	m.output.SetContent(b.String())
+	if atBottom {
+		m.output.GotoBottom()
+	}
+}
+
+// schedule starts every pending step whose dependencies are done, without
+// exceeding the worker limit.
+func (m *setupModel) schedule() tea.Cmd {
+	m.skipBlocked()
+	if m.abort != abortNone {
+		return nil
+	}
+	var cmds []tea.Cmd
+	for i, s := range m.steps {
+		if m.running >= m.jobs {
+			break
+		}
+		if m.status[i] != statusPending || !m.ready(s) {
+			continue
+		}
+		m.status[i] = statusRunning
+		m.running++
+		m.attempt[i] = 1
+		m.started[i] = time.Now()
+		if m.plain != nil {
+			m.println("→ " + s.description)
+		}
+		cmds = append(cmds, m.runCommand(i, 1))
+	}
+	return tea.Batch(cmds...)
+}
+
+// ready reports whether all dependencies of s are done, or failed with a
+// warning. Dependencies that are not part of the plan (e.g. already
+// satisfied) do not block.
+func (m *setupModel) ready(s step) bool {
+	for _, dep := range s.deps {
+		if i, ok := m.index[dep]; ok && m.status[i] != statusDone && m.status[i] != statusWarned {
+			return false
+		}
+	}
+	return true
+}
+
+// record stores the result of a step in the state file.
+func (m *setupModel) record(msg commandResultMsg) tea.Cmd {
+	if m.state == nil {
+		return nil
+	}
+	s := m.steps[msg.stepIndex]
+	status := state.StatusDone
+	switch {
+	case msg.cancelled:
+		status = state.StatusCancelled
+	case msg.err != nil:
+		status = state.StatusFailed
+	}
+	err := m.state.Record(state.StepRecord{
+		ID:          s.id,
+		Description: s.description,
+		Status:      status,
+		ExitCode:    msg.exitCode,
+		StartedAt:   m.started[msg.stepIndex],
+		FinishedAt:  msg.finishedAt,
+	})
+	if err != nil {
+		return m.println(skipped(fmt.Sprintf("No se pudo guardar el estado: %v", err)))
+	}
+	return nil
+}
+
+// println prints a line above the spinners, or right away in plain mode.
+func (m *setupModel) println(line string) tea.Cmd {
+	if m.plain != nil {
+		fmt.Fprintln(m.plain, line)
+		return nil
+	}
+	return tea.Println(line)
+}
+
+// abortNow kills every running step and stops scheduling new ones.
+func (m *setupModel) abortNow() {
+	m.abort = abortNow
+	m.cancel()
+}
+
+// skipBlocked marks as skipped the pending steps that depend on a failed
+// or skipped step. Steps are ordered after their dependencies, so a single
+// pass propagates the skip through the whole chain.
+func (m *setupModel) skipBlocked() {
+	for i, s := range m.steps {
+		if m.status[i] != statusPending {
+			continue
+		}
+		for _, dep := range s.deps {
+			j, ok := m.index[dep]
+			if ok && (m.status[j] == statusFailed || m.status[j] == statusSkipped) {
+				m.status[i] = statusSkipped
+				break
+			}
+		}
+	}
+}
+
+// logAttempt writes an attempt of a step to the run log.
+func (m *setupModel) logAttempt(msg commandResultMsg, status string) {
+	s := m.steps[msg.stepIndex]
+	e := runlog.Entry{
+		Type:        runlog.TypeStep,
+		StepID:      s.id,
+		Description: s.description,
+		Command:     s.command,
+		Args:        s.args,
+		Action:      s.actionString(),
+		Env:         s.env,
+		Attempt:     msg.attempt,
+		StartedAt:   msg.startedAt,
+		FinishedAt:  msg.finishedAt,
+		ExitCode:    msg.exitCode,
+		Output:      runlog.Truncate(msg.output, runlog.MaxOutput),
+		Status:      status,
+	}
+	if msg.err != nil {
+		e.Error = msg.err.Error()
+	}
+	// A broken log must not break the setup itself.
+	_ = m.log.Write(e)
+}
+
+// finished reports whether every step reached a final status.
+func (m *setupModel) finished() bool {
+	m.skipBlocked()
+	for _, st := range m.status {
+		if st == statusPending || st == statusRunning {
+			return false
+		}
+	}
+	return true
+}
+
+// failed reports whether any step failed.
+func (m *setupModel) failed() bool {
+	return slices.Contains(m.status, statusFailed)
+}
+
+// execCommand returns the command the executor runs for the step.
+func (s step) execCommand() executor.Command {
+	env := s.env
+	if s.brewPath {
+		env = append(slices.Clone(env), brewPathEnv())
+	}
+	return executor.Command{Name: s.command, Args: s.args, Env: env}
+}
+
+// actionString describes the native action of the step, if any.
+func (s step) actionString() string {
+	if s.action == nil {
+		return ""
+	}
+	return s.action.String()
+}
+
+// name returns the package installed by the step, or its description.
+func (s step) name() string {
+	if s.pkg != "" {
+		return s.pkg
+	}
+	return s.description
+}
+
+// runCommand returns a Tea command that executes one attempt of a step,
+// streaming its output to the model. A successful attempt is then verified
+// with the step checks, and fails if any of them does not pass.
+// The step env (e.g. NONINTERACTIVE=1 for Homebrew) extends the current one.
+//
+// Each attempt runs under its own context, bounded by the step timeout and
+// cancelled together with the model context when the user aborts.
+func (m *setupModel) runCommand(index, attempt int) tea.Cmd {
+	s := m.steps[index]
+	lines := m.lines
+	root := m.ctx
+	ctx, cancel := context.WithCancel(root)
+	if s.timeout > 0 {
+		ctx, cancel = context.WithTimeout(root, s.timeout)
+	}
+	ex := m.exec
+	return func() tea.Msg {
+		defer cancel()
+		startedAt := time.Now()
+		output, err := runStreaming(ctx, ex, s, index, lines)
+		var verifyErr error
+		if err == nil {
+			verifyErr = verifyPackage(ctx, ex, s.pkg, s.verify)
+		}
+		if err == nil && verifyErr == nil && s.version != "" {
+			verifyErr = verifyVersion(ctx, ex, s)
+		}
+		msg := commandResultMsg{
+			stepIndex:  index,
+			attempt:    attempt,
+			exitCode:   executor.ExitCode(err),
+			output:     output,
+			startedAt:  startedAt,
+			finishedAt: time.Now(),
+		}
+		switch {
+		case err == nil && verifyErr == nil:
+		case root.Err() != nil:
+			msg.cancelled = true
+			msg.err = fmt.Errorf("%q cancelado", s.description)
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			msg.err = fmt.Errorf("%q superó el tiempo límite de %s", s.description, s.timeout)
+		case verifyErr != nil:
+			msg.err = fmt.Errorf("%q no pasó la verificación: %v", s.description, verifyErr)
+		default:
+			msg.err = fmt.Errorf("%q failed: %v", s.description, err)
+		}
+		return msg
+	}
+}
+
+// newSetupModel creates a new setup model with our steps and a single spinner
+// shared by every running step.
+func newSetupModel(steps []step, opts engineOptions) *setupModel {
+	sp := spinner.New()
+	sp.Style = spinnerStyle
+	sp.Spinner = spinner.Line
+	index := make(map[string]int, len(steps))
+	for i, s := range steps {
+		index[s.id] = i
+	}
+	jobs := max(opts.jobs, 1)
+	ex := opts.exec
+	if ex == nil {
+		ex = executor.System{}
+	}
+	tails := make([]tailBuffer, len(steps))
+	for i := range tails {
+		tails[i].max = maxOutputLines
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &setupModel{
+		spinner:  sp,
+		steps:    steps,
+		status:   make([]stepStatus, len(steps)),
+		attempt:  make([]int, len(steps)),
+		started:  make([]time.Time, len(steps)),
+		ended:    make([]time.Time, len(steps)),
+		exitCode: make([]int, len(steps)),
+		caveats:  make([]string, len(steps)),
+		errs:     make([]error, len(steps)),
+		outputs:  make([][]byte, len(steps)),
+		index:    index,
+		jobs:     jobs,
+		state:    opts.state,
+		exec:     ex,
+		log:      opts.log,
+		plain:    opts.plain,
+
+		keepGoing: opts.keepGoing,
+
+		lines:  make(chan outputLineMsg, 256),
+		tails:  tails,
+		output: viewport.New(80, outputHeight),
+
+		bar:       newProgressBar(),
+		estimates: stepEstimates(steps, opts.history),
+		history:   opts.history,
+
+		ctx:    ctx,
+		cancel: cancel,
+
+		done: false,
+	}
+}
@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"paisanos-cli/cmd/catalog"
+	"paisanos-cli/cmd/executor"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// testStep returns a step that runs the command id after deps.
+func testStep(id string, deps ...string) step {
+	return step{id: id, description: id, command: id, deps: deps}
+}
+
+// runSteps runs steps on ex in plain mode, calling during, if any, while
+// they run, and returns the finished model.
+func runSteps(t *testing.T, ex *executor.Fake, steps []step, opts engineOptions, during func(*tea.Program)) *setupModel {
+	t.Helper()
+	opts.exec = ex
+	opts.plain = io.Discard
+	m := newSetupModel(steps, opts)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	p := tea.NewProgram(m, tea.WithContext(ctx), tea.WithoutRenderer(), tea.WithInput(nil),
+		tea.WithoutSignalHandler(), tea.WithOutput(io.Discard))
+	if during != nil {
+		go during(p)
+	}
+	if _, err := p.Run(); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	return m
+}
+
+// statusOf returns the status of the step id.
+func statusOf(m *setupModel, id string) stepStatus {
+	return m.status[m.index[id]]
+}
+
+// callNames returns the names of the commands run on ex, in order.
+func callNames(ex *executor.Fake) []string {
+	var names []string
+	for _, c := range ex.Calls() {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// waitForCalls blocks until ex ran at least n commands.
+func waitForCalls(ex *executor.Fake, n int) {
+	for len(ex.Calls()) < n {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEngineDependencies(t *testing.T) {
+	ex := executor.NewFake()
+	ex.Default = executor.Response{Delay: 10 * time.Millisecond}
+	steps := []step{
+		testStep("a"),
+		testStep("b", "a"),
+		testStep("c", "a", "already-done"), // deps outside the plan never block
+		testStep("d", "b", "c"),
+	}
+	m := runSteps(t, ex, steps, engineOptions{jobs: 4}, nil)
+
+	calls := callNames(ex)
+	if len(calls) != 4 || calls[0] != "a" || calls[3] != "d" {
+		t.Errorf("calls = %q, want a, then b and c, then d", calls)
+	}
+	for _, s := range steps {
+		if st := statusOf(m, s.id); st != statusDone {
+			t.Errorf("%s: status %d, want done", s.id, st)
+		}
+	}
+}
+
+func TestEngineJobs(t *testing.T) {
+	ex := executor.NewFake()
+	ex.Default = executor.Response{Delay: 20 * time.Millisecond}
+	steps := []step{testStep("a"), testStep("b"), testStep("c")}
+	start := time.Now()
+	runSteps(t, ex, steps, engineOptions{jobs: 1}, nil)
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("three 20ms steps took %s with one job, want them one at a time", elapsed)
+	}
+	if calls := callNames(ex); !slices.Equal(calls, []string{"a", "b", "c"}) {
+		t.Errorf("calls = %q, want plan order", calls)
+	}
+}
+
+func TestEngineFailFast(t *testing.T) {
+	ex := executor.NewFake()
+	ex.On("fail", executor.Response{ExitCode: 1})
+	ex.On("slow", executor.Response{Delay: 5 * time.Second})
+	steps := []step{
+		testStep("slow"),
+		testStep("fail"),
+		testStep("later"),
+		testStep("child", "fail"),
+	}
+	start := time.Now()
+	m := runSteps(t, ex, steps, engineOptions{jobs: 2}, nil)
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("run took %s, want the slow step killed", elapsed)
+	}
+
+	want := map[string]stepStatus{
+		"slow":  statusCancelled,
+		"fail":  statusFailed,
+		"later": statusPending,
+		"child": statusSkipped,
+	}
+	for id, st := range want {
+		if got := statusOf(m, id); got != st {
+			t.Errorf("%s: status %d, want %d", id, got, st)
+		}
+	}
+	if m.err == nil || !strings.Contains(m.err.Error(), `"fail"`) {
+		t.Errorf("err = %v, want the failure of fail", m.err)
+	}
+}
+
+func TestEngineKeepGoing(t *testing.T) {
+	ex := executor.NewFake()
+	ex.On("fail", executor.Response{ExitCode: 1})
+	ex.On("slow", executor.Response{Delay: 20 * time.Millisecond})
+	steps := []step{
+		testStep("slow"),
+		testStep("fail"),
+		testStep("later"),
+		testStep("child", "fail"),
+		testStep("grandchild", "child"),
+	}
+	m := runSteps(t, ex, steps, engineOptions{jobs: 2, keepGoing: true}, nil)
+
+	want := map[string]stepStatus{
+		"slow":       statusDone,
+		"fail":       statusFailed,
+		"later":      statusDone,
+		"child":      statusSkipped,
+		"grandchild": statusSkipped,
+	}
+	for id, st := range want {
+		if got := statusOf(m, id); got != st {
+			t.Errorf("%s: status %d, want %d", id, got, st)
+		}
+	}
+	if m.err != nil {
+		t.Errorf("err = %v, want nil with keepGoing", m.err)
+	}
+}
+
+func TestEngineWarnDoesNotBlock(t *testing.T) {
+	ex := executor.NewFake()
+	ex.On("hook", executor.Response{ExitCode: 1})
+	hook := testStep("hook")
+	hook.warn = true
+	m := runSteps(t, ex, []step{hook, testStep("next", "hook")}, engineOptions{jobs: 1}, nil)
+	if statusOf(m, "hook") != statusWarned || statusOf(m, "next") != statusDone {
+		t.Errorf("statuses = %d, %d, want warned, done", statusOf(m, "hook"), statusOf(m, "next"))
+	}
+}
+
+func TestEngineRetry(t *testing.T) {
+	policy := retryPolicy{maxAttempts: 3, backoff: 20 * time.Millisecond, patterns: brewRetryPatterns}
+	tests := []struct {
+		name      string
+		responses []executor.Response
+		status    stepStatus
+		attempts  int
+	}{
+		{
+			name: "transient failures",
+			responses: []executor.Response{
+				{ExitCode: 1, Output: "Error: Another active Homebrew update process is already in progress.\n"},
+				{ExitCode: 1, Output: "curl: (56) Recv failure: Connection reset by peer\n"},
+				{},
+			},
+			status:   statusDone,
+			attempts: 3,
+		},
+		{
+			name:      "permanent failure",
+			responses: []executor.Response{{ExitCode: 1, Output: "Error: No available formula with the name \"nope\".\n"}},
+			status:    statusFailed,
+			attempts:  1,
+		},
+		{
+			name:      "attempts exhausted",
+			responses: []executor.Response{{ExitCode: 1, Output: "curl: (6) Could not resolve host: ghcr.io\n"}},
+			status:    statusFailed,
+			attempts:  3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex := executor.NewFake()
+			ex.On("brew install nope", tt.responses...)
+			s := step{id: "formula:nope", description: "nope", command: "brew", args: []string{"install", "nope"}, retry: policy}
+			start := time.Now()
+			m := runSteps(t, ex, []step{s}, engineOptions{jobs: 1}, nil)
+			elapsed := time.Since(start)
+
+			if got := statusOf(m, s.id); got != tt.status {
+				t.Errorf("status %d, want %d", got, tt.status)
+			}
+			if got := len(ex.Calls()); got != tt.attempts {
+				t.Errorf("%d attempts, want %d", got, tt.attempts)
+			}
+			// The backoff doubles: 20ms before the second attempt, 40ms
+			// before the third.
+			var backoff time.Duration
+			for i := 1; i < tt.attempts; i++ {
+				backoff += policy.delay(i)
+			}
+			if elapsed < backoff {
+				t.Errorf("run took %s, want at least the backoff %s", elapsed, backoff)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{5, 30 * time.Second},
+		{64, 30 * time.Second}, // the shift overflows
+	}
+	for _, tt := range tests {
+		if got := brewRetry.delay(tt.attempt); got != tt.want {
+			t.Errorf("delay(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestEngineCancel(t *testing.T) {
+	ex := executor.NewFake()
+	ex.On("slow", executor.Response{Delay: 5 * time.Second})
+	steps := []step{testStep("slow"), testStep("after", "slow")}
+	start := time.Now()
+	m := runSteps(t, ex, steps, engineOptions{jobs: 1}, func(p *tea.Program) {
+		waitForCalls(ex, 1)
+		p.Send(interruptMsg{})
+	})
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("run took %s, want the slow step killed", elapsed)
+	}
+	if statusOf(m, "slow") != statusCancelled || statusOf(m, "after") != statusPending {
+		t.Errorf("statuses = %d, %d, want cancelled, pending", statusOf(m, "slow"), statusOf(m, "after"))
+	}
+	if !m.userAborted {
+		t.Error("userAborted = false, want true")
+	}
+}
+
+func TestEngineCancelDuringBackoff(t *testing.T) {
+	ex := executor.NewFake()
+	ex.On("flaky", executor.Response{ExitCode: 1})
+	s := testStep("flaky")
+	s.retry = retryPolicy{maxAttempts: 3, backoff: 5 * time.Second}
+	start := time.Now()
+	m := runSteps(t, ex, []step{s}, engineOptions{jobs: 1}, func(p *tea.Program) {
+		waitForCalls(ex, 1)
+		p.Send(interruptMsg{})
+	})
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("run took %s, want the backoff cut short", elapsed)
+	}
+	if got := statusOf(m, "flaky"); got != statusCancelled {
+		t.Errorf("status %d, want cancelled", got)
+	}
+	if got := len(ex.Calls()); got != 1 {
+		t.Errorf("%d attempts, want the retry dropped", got)
+	}
+}
+
+func TestEngineTimeout(t *testing.T) {
+	ex := executor.NewFake()
+	ex.On("hang", executor.Response{Delay: 5 * time.Second})
+	s := testStep("hang")
+	s.timeout = 20 * time.Millisecond
+	m := runSteps(t, ex, []step{s, testStep("next", "hang")}, engineOptions{jobs: 1, keepGoing: true}, nil)
+	if got := statusOf(m, "hang"); got != statusFailed {
+		t.Fatalf("status %d, want failed", got)
+	}
+	if err := m.errs[m.index["hang"]]; !strings.Contains(err.Error(), "tiempo límite") {
+		t.Errorf("err = %v, want a timeout", err)
+	}
+	if got := statusOf(m, "next"); got != statusSkipped {
+		t.Errorf("next: status %d, want skipped", got)
+	}
+}
+
+func TestEngineBrewMissing(t *testing.T) {
+	ex := executor.NewFake()
+	fnm := catalog.Package{Name: "fnm", Kind: catalog.KindFormula}
+	p := buildPlan(ex, []catalog.Package{fnm}, nil, detection{}, "/Users/ana/.zprofile")
+	m := runSteps(t, ex, p.steps, engineOptions{jobs: 4}, nil)
+
+	for _, s := range p.steps {
+		if st := statusOf(m, s.id); st != statusDone {
+			t.Errorf("%s: status %d, want done", s.id, st)
+		}
+	}
+	calls := ex.Calls()
+	var lines []string
+	for _, c := range calls {
+		lines = append(lines, c.String())
+	}
+	want := []string{
+		"/bin/bash -c $(curl -fsSL https://raw.githubusercontent.com/Homebrew/install/HEAD/install.sh)",
+		"agregar a /Users/ana/.zprofile",
+		`/bin/bash -c eval "$(/opt/homebrew/bin/brew shellenv)"`,
+		"brew update",
+		"brew install fnm",
+	}
+	if !slices.Equal(lines, want) {
+		t.Fatalf("calls =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+	// brew is not on the PATH of paisanos yet, only on the one of its steps.
+	for _, c := range calls[3:] {
+		if !slices.ContainsFunc(c.Env, func(e string) bool { return strings.HasPrefix(e, "PATH=/opt/homebrew/bin:") }) {
+			t.Errorf("%s: env %q, want Homebrew first in PATH", c, c.Env)
+		}
+	}
+	if !slices.Contains(calls[0].Env, "NONINTERACTIVE=1") {
+		t.Errorf("installer env %q, want NONINTERACTIVE=1", calls[0].Env)
+	}
+}
@@ -0,0 +1,166 @@
+// Package executor abstracts process execution so the setup engine can run
+// against the real system or a scripted fake.
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// killWaitDelay bounds how long a killed command may keep its output open.
+const killWaitDelay = 5 * time.Second
+
+// Command describes a process to run.
+type Command struct {
+	Name string
+	Args []string
+	Env  []string // extra KEY=value pairs added to the current environment
+	// Stdin is fed to the standard input, which is empty otherwise.
+	Stdin string
+}
+
+// String returns the command line, e.g. "brew install fnm".
+func (c Command) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+// Action is an operation implemented natively, such as writing a file.
+type Action interface {
+	// Done reports whether the action is already applied.
+	Done() (bool, error)
+	// Apply performs the action, writing progress to out.
+	Apply(ctx context.Context, out io.Writer) error
+	// String describes the action, e.g. "crear directorio ~/Code".
+	String() string
+}
+
+// Executor runs processes and inspects the system.
+type Executor interface {
+	// Run executes cmd writing its combined stdout and stderr to out. When
+	// ctx is cancelled the command and all its children are killed.
+	Run(ctx context.Context, cmd Command, out io.Writer) error
+	// Do applies a unless it is already done, writing progress to out.
+	Do(ctx context.Context, a Action, out io.Writer) error
+	// LookPath searches for an executable named name in PATH.
+	LookPath(name string) (string, error)
+	// Probe runs cmd discarding its output and reports whether it succeeded.
+	Probe(ctx context.Context, cmd Command) bool
+	// Exists reports whether path exists.
+	Exists(path string) bool
+}
+
+// ExitError is returned by executors that do not run real processes.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// ExitCode returns the exit code carried by err, 0 for nil and -1 if the
+// process could not be started.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	var fakeErr *ExitError
+	if errors.As(err, &fakeErr) {
+		return fakeErr.Code
+	}
+	return -1
+}
+
+// System runs real processes.
+type System struct{}
+
+// Run implements Executor.
+func (System) Run(ctx context.Context, c Command, out io.Writer) error {
+	cmd := command(ctx, c)
+	setProcessGroup(cmd)
+	cmd.WaitDelay = killWaitDelay
+	if c.Stdin != "" {
+		cmd.Stdin = strings.NewReader(c.Stdin)
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	return cmd.Run()
+}
+
+// Do implements Executor.
+func (System) Do(ctx context.Context, a Action, out io.Writer) error {
+	done, err := a.Done()
+	if err != nil {
+		return err
+	}
+	if done {
+		fmt.Fprintf(out, "Sin cambios: %s\n", a)
+		return nil
+	}
+	return a.Apply(ctx, out)
+}
+
+// LookPath implements Executor.
+func (System) LookPath(name string) (string, error) {
+	return exec.LookPath(name)
+}
+
+// Probe implements Executor.
+func (System) Probe(ctx context.Context, c Command) bool {
+	return command(ctx, c).Run() == nil
+}
+
+// Exists implements Executor.
+func (System) Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// command returns the process that runs c. A PATH in c.Env is also used to
+// find c.Name, which exec.Command looks up in our own PATH.
+func command(ctx context.Context, c Command) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	if len(c.Env) == 0 {
+		return cmd
+	}
+	cmd.Env = append(os.Environ(), c.Env...)
+	if strings.Contains(c.Name, "/") {
+		return cmd
+	}
+	for _, e := range slices.Backward(c.Env) {
+		if dirs, ok := strings.CutPrefix(e, "PATH="); ok {
+			if path, err := lookPathIn(c.Name, dirs); err == nil {
+				cmd.Path, cmd.Err = path, nil
+			}
+			break
+		}
+	}
+	return cmd
+}
+
+// lookPathIn searches for the executable name in the directories of the
+// PATH-style list dirs.
+func lookPathIn(name, dirs string) (string, error) {
+	for _, dir := range filepath.SplitList(dirs) {
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() && info.Mode()&0o111 != 0 {
+			return path, nil
+		}
+	}
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
@@ -0,0 +1,37 @@
+//go:build unix
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSystemRunEnvPath(t *testing.T) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho hola\n"
+	if err := os.WriteFile(filepath.Join(dir, "paisanos-test-bin"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	c := Command{Name: "paisanos-test-bin"}
+	if err := (System{}).Run(context.Background(), c, &bytes.Buffer{}); err == nil {
+		t.Fatal("Run without PATH succeeded, want not found")
+	}
+
+	// As right after installing Homebrew: only the step env knows the dir.
+	c.Env = []string{"PATH=" + dir + string(os.PathListSeparator) + os.Getenv("PATH")}
+	var out bytes.Buffer
+	if err := (System{}).Run(context.Background(), c, &out); err != nil {
+		t.Fatalf("Run with PATH in env: %v", err)
+	}
+	if strings.TrimSpace(out.String()) != "hola" {
+		t.Errorf("output = %q, want hola", out.String())
+	}
+	if !(System{}).Probe(context.Background(), c) {
+		t.Error("Probe with PATH in env failed")
+	}
+}
@@ -0,0 +1,143 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Response is the scripted outcome of a command run by Fake.
+type Response struct {
+	Output   string        // written to the output, line by line
+	ExitCode int           // non-zero makes the command fail
+	Delay    time.Duration // how long the command "runs"
+	// After is called once the command succeeds, e.g. to make a binary
+	// appear on PATH after its installer ran.
+	After func(f *Fake)
+}
+
+// Fake is a scriptable Executor. Commands are matched by their full command
+// line (see Command.String) and actions by their String, which is also
+// recorded as the command name; unscripted ones get the Default response.
+// It is safe for concurrent use.
+type Fake struct {
+	Default Response
+
+	mu        sync.Mutex
+	responses map[string][]Response
+	paths     map[string]string
+	files     map[string]bool
+	calls     []Command
+}
+
+// NewFake returns a Fake where every command succeeds, no executable is on
+// PATH and no file exists.
+func NewFake() *Fake {
+	return &Fake{
+		responses: make(map[string][]Response),
+		paths:     make(map[string]string),
+		files:     make(map[string]bool),
+	}
+}
+
+// On scripts the responses of a command line. Successive runs consume the
+// responses in order and the last one repeats.
+func (f *Fake) On(cmdline string, responses ...Response) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses[cmdline] = responses
+	return f
+}
+
+// SetPath makes LookPath(name) succeed with path.
+func (f *Fake) SetPath(name, path string) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.paths[name] = path
+	return f
+}
+
+// AddFile makes Exists(path) report true.
+func (f *Fake) AddFile(path string) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[path] = true
+	return f
+}
+
+// Calls returns every command run or probed so far, in order.
+func (f *Fake) Calls() []Command {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Command(nil), f.calls...)
+}
+
+// next records c and returns its scripted response.
+func (f *Fake) next(c Command) Response {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, c)
+	line := c.String()
+	rs, ok := f.responses[line]
+	if !ok || len(rs) == 0 {
+		return f.Default
+	}
+	r := rs[0]
+	if len(rs) > 1 {
+		f.responses[line] = rs[1:]
+	}
+	return r
+}
+
+// Run implements Executor.
+func (f *Fake) Run(ctx context.Context, c Command, out io.Writer) error {
+	r := f.next(c)
+	if r.Delay > 0 {
+		select {
+		case <-time.After(r.Delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if r.Output != "" {
+		if _, err := io.WriteString(out, r.Output); err != nil {
+			return err
+		}
+	}
+	if r.ExitCode != 0 {
+		return &ExitError{Code: r.ExitCode}
+	}
+	if r.After != nil {
+		r.After(f)
+	}
+	return nil
+}
+
+// Do implements Executor. The action itself is never applied.
+func (f *Fake) Do(ctx context.Context, a Action, out io.Writer) error {
+	return f.Run(ctx, Command{Name: a.String()}, out)
+}
+
+// LookPath implements Executor.
+func (f *Fake) LookPath(name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if p, ok := f.paths[name]; ok {
+		return p, nil
+	}
+	return "", fmt.Errorf("exec: %q: executable file not found in $PATH", name)
+}
+
+// Probe implements Executor.
+func (f *Fake) Probe(ctx context.Context, c Command) bool {
+	return f.Run(ctx, c, io.Discard) == nil
+}
+
+// Exists implements Executor.
+func (f *Fake) Exists(path string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.files[path]
+}
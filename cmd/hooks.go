@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"paisanos-cli/cmd/action"
+	"paisanos-cli/cmd/catalog"
+	"paisanos-cli/cmd/executor"
+)
+
+// Step ID prefixes of the run-level hooks.
+const (
+	stepHookBefore = "hook:before"
+	stepHookAfter  = "hook:after"
+)
+
+// hookSteps returns the steps that run hooks one after the other, the first
+// one depending on deps. Step IDs are prefix:1, prefix:2 and so on.
+func hookSteps(prefix string, hooks []catalog.Hook, deps []string) []step {
+	steps := make([]step, 0, len(hooks))
+	for i, h := range hooks {
+		s := step{
+			id:          fmt.Sprintf("%s:%d", prefix, i+1),
+			description: hookDescription(h),
+			action:      hookAction(h),
+			deps:        deps,
+			warn:        h.OnFailure == catalog.HookWarn,
+			privileged:  h.Privileged,
+		}
+		if s.action == nil {
+			s.command = "/bin/bash"
+			s.args = []string{"-c", h.Run}
+		}
+		steps = append(steps, s)
+		deps = []string{s.id}
+	}
+	return steps
+}
+
+// hookAction returns the native action of h, or nil for shell hooks.
+func hookAction(h catalog.Hook) executor.Action {
+	switch h.Type {
+	case catalog.HookWrite:
+		return action.WriteFile{Path: h.Path, Content: h.Content, Mode: h.FileMode()}
+	case catalog.HookAppend:
+		return action.AppendFile{Path: h.Path, Content: h.Content, Mode: h.FileMode()}
+	case catalog.HookSymlink:
+		return action.Symlink{Path: h.Path, Target: h.Target}
+	case catalog.HookTemplate:
+		return action.Template{Path: h.Path, Text: h.Content, Mode: h.FileMode()}
+	case catalog.HookDownload:
+		return action.Download{URL: h.URL, Path: h.Path, SHA256: h.SHA256, Mode: h.FileMode()}
+	case catalog.HookMkdir:
+		return action.Mkdir{Path: h.Path, Mode: h.FileMode()}
+	}
+	return nil
+}
+
+// hookDescription returns the text shown while h runs.
+func hookDescription(h catalog.Hook) string {
+	if h.Description != "" {
+		return h.Description
+	}
+	if a := hookAction(h); a != nil {
+		desc := a.String()
+		return strings.ToUpper(desc[:1]) + desc[1:] + "..."
+	}
+	return fmt.Sprintf("Ejecutando `%s`...", h.Run)
+}
+
+// withHooks wraps the plan with the run-level hooks: before hooks run first
+// and every step without dependencies waits for them, after hooks run once
+// every other step is done, with Homebrew on PATH like the installs.
+func (p plan) withHooks(before, after []catalog.Hook) plan {
+	pre := hookSteps(stepHookBefore, before, nil)
+	if len(pre) > 0 {
+		last := []string{pre[len(pre)-1].id}
+		for i := range p.steps {
+			if len(p.steps[i].deps) == 0 {
+				p.steps[i].deps = last
+			}
+		}
+	}
+	var all []string
+	for _, s := range slices.Concat(pre, p.steps) {
+		all = append(all, s.id)
+	}
+	post := hookSteps(stepHookAfter, after, all)
+	p.steps = slices.Concat(pre, p.steps, post)
+	p.setBrewPath()
+	return p
+}
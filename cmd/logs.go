@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"paisanos-cli/cmd/executor"
+	"paisanos-cli/cmd/runlog"
+
+	"github.com/spf13/cobra"
+)
+
+// startRunLog opens the log of a new setup run and records the steps that
+// will not run. Failing to create the log only prints a warning.
+func startRunLog(p plan, completed []step) *runlog.Log {
+	log, err := runlog.Create(time.Now())
+	if err != nil {
+		fmt.Fprintln(humanOutput(), skipped(fmt.Sprintf("No se pudo crear el log de la ejecución: %v", err)))
+		return nil
+	}
+	hostname, _ := os.Hostname()
+	_ = log.Write(runlog.Entry{
+		Type:     runlog.TypeRunStart,
+		Version:  Version,
+		Hostname: hostname,
+		OS:       runtime.GOOS + "/" + runtime.GOARCH,
+	})
+	for _, pkg := range p.skipped {
+		_ = log.Write(runlog.Entry{Type: runlog.TypeStep, StepID: packageStepID(pkg), Description: pkg.Name, Status: runlog.StepPresent})
+	}
+	for _, v := range p.incompatible {
+		_ = log.Write(runlog.Entry{Type: runlog.TypeStep, StepID: packageStepID(v.pkg), Description: v.String(), Status: runlog.StepIncompatible})
+	}
+	for _, s := range completed {
+		_ = log.Write(runlog.Entry{Type: runlog.TypeStep, StepID: s.id, Description: s.description, Status: runlog.StepResumed})
+	}
+	return log
+}
+
+// endRunLog records how the run finished and closes the log.
+func endRunLog(log *runlog.Log, m *setupModel) {
+	if log == nil {
+		return
+	}
+	status := runlog.RunSuccess
+	switch {
+	case m.userAborted:
+		status = runlog.RunAborted
+	case m.failed():
+		status = runlog.RunFailed
+	}
+	_ = log.Write(runlog.Entry{Type: runlog.TypeRunEnd, Status: status})
+	_ = log.Close()
+}
+
+// LogsCmd lists the past setup runs or prints one of them.
+var LogsCmd = &cobra.Command{
+	Use:   "logs [run-id|last]",
+	Short: "Lista las ejecuciones anteriores del setup o muestra una",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		runs, err := runlog.List()
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			return printRuns(cmd, runs)
+		}
+		id := args[0]
+		if id == "last" {
+			if len(runs) == 0 {
+				return fmt.Errorf("no hay ejecuciones registradas")
+			}
+			id = runs[0].ID
+		}
+		entries, err := runlog.Read(id)
+		if err != nil {
+			return err
+		}
+		printRun(cmd, id, entries)
+		return nil
+	},
+}
+
+func printRuns(cmd *cobra.Command, runs []runlog.Run) error {
+	out := cmd.OutOrStdout()
+	if len(runs) == 0 {
+		fmt.Fprintln(out, "No hay ejecuciones registradas.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tFECHA\tESTADO\tPASOS\tFALLIDOS")
+	for _, r := range runs {
+		status := r.Status
+		if status == "" {
+			status = "incompleta"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\n", r.ID, r.StartedAt.Format("2006-01-02 15:04"), status, r.Steps, r.Failed)
+	}
+	return tw.Flush()
+}
+
+// printRun prints the entries of a run in a human-readable form.
+func printRun(cmd *cobra.Command, id string, entries []runlog.Entry) {
+	out := cmd.OutOrStdout()
+	for _, e := range entries {
+		switch e.Type {
+		case runlog.TypeRunStart:
+			fmt.Fprintf(out, "Ejecución %s — %s\n", id, e.Time.Format("2006-01-02 15:04:05"))
+			fmt.Fprintf(out, "paisanos %s en %s (%s)\n", e.Version, e.Hostname, e.OS)
+			fmt.Fprintln(out)
+		case runlog.TypeStep:
+			printLogStep(cmd, e)
+		case runlog.TypeRunEnd:
+			fmt.Fprintf(out, "\nResultado: %s (%s)\n", e.Status, e.Time.Format("15:04:05"))
+		}
+	}
+}
+
+func printLogStep(cmd *cobra.Command, e runlog.Entry) {
+	out := cmd.OutOrStdout()
+	switch e.Status {
+	case runlog.StepPresent:
+		fmt.Fprintf(out, "■ %s ya se encontraba instalado\n", e.Description)
+		return
+	case runlog.StepResumed:
+		fmt.Fprintf(out, "■ %s completado en una ejecución anterior\n", e.Description)
+		return
+	case runlog.StepIncompatible:
+		fmt.Fprintf(out, "⚠ %s: versión incompatible, no se modificó\n", e.Description)
+		return
+	}
+
+	marks := map[string]string{
+		runlog.StepDone:      "✔",
+		runlog.StepFailed:    "✘",
+		runlog.StepWarned:    "⚠",
+		runlog.StepCancelled: "■",
+		runlog.StepRetrying:  "↻",
+	}
+	fmt.Fprintf(out, "%s %s [%s] intento %d, exit %d, %s\n",
+		marks[e.Status], e.Description, e.StepID, e.Attempt, e.ExitCode,
+		e.FinishedAt.Sub(e.StartedAt).Round(time.Millisecond))
+	if e.Action != "" {
+		fmt.Fprintf(out, "    %s\n", e.Action)
+	} else {
+		cmdline := executor.Command{Name: e.Command, Args: e.Args}.String()
+		if len(e.Env) > 0 {
+			cmdline = strings.Join(e.Env, " ") + " " + cmdline
+		}
+		fmt.Fprintf(out, "    $ %s\n", cmdline)
+	}
+	if e.Error != "" {
+		fmt.Fprintf(out, "    error: %s\n", e.Error)
+	}
+	if e.Status != runlog.StepDone && e.Output != "" {
+		for _, line := range strings.Split(strings.TrimRight(e.Output, "\n"), "\n") {
+			fmt.Fprintf(out, "    | %s\n", line)
+		}
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(LogsCmd)
+}
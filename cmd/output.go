@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"paisanos-cli/cmd/executor"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// maxOutputLines is how many output lines are kept per step.
+	maxOutputLines = 100
+	// outputHeight is the height of the output pane.
+	outputHeight = 10
+)
+
+// outputLineMsg carries a line printed by a running step.
+type outputLineMsg struct {
+	stepIndex int
+	line      string
+}
+
+// tailBuffer keeps the last max lines written to it.
+type tailBuffer struct {
+	lines []string
+	max   int
+}
+
+func (t *tailBuffer) add(line string) {
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.max {
+		t.lines = t.lines[len(t.lines)-t.max:]
+	}
+}
+
+// waitForOutput returns a command that delivers the next streamed line.
+func waitForOutput(lines <-chan outputLineMsg) tea.Cmd {
+	return func() tea.Msg {
+		return <-lines
+	}
+}
+
+// runStreaming runs the step s with ex sending every stdout/stderr line to
+// lines, and returns the full combined output.
+func runStreaming(ctx context.Context, ex executor.Executor, s step, index int, lines chan<- outputLineMsg) ([]byte, error) {
+	pr, pw := io.Pipe()
+
+	var full bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r := io.TeeReader(pr, &full)
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 64*1024), 1024*1024)
+		for sc.Scan() {
+			// Progress bars redraw the line with \r; keep the last frame.
+			line := sc.Text()
+			line = line[strings.LastIndex(line, "\r")+1:]
+			lines <- outputLineMsg{stepIndex: index, line: line}
+		}
+		// Keep draining so the command never blocks on a full pipe.
+		_, _ = io.Copy(io.Discard, r)
+	}()
+
+	var err error
+	if s.action != nil {
+		err = ex.Do(ctx, s.action, pw)
+	} else {
+		err = ex.Run(ctx, s.execCommand(), pw)
+	}
+	pw.Close()
+	<-done
+	return full.Bytes(), err
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-isatty"
+)
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
+}
+
+// humanOutput returns where the setup prints its prompts and progress:
+// stderr when stdout carries the plan or the JSON results, stdout otherwise.
+func humanOutput() *os.File {
+	if dryRun || outputFormat == outputJSON {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// interactive reports whether the setup can show Bubble Tea programs: not
+// disabled with --no-tui, and both stdin and humanOutput are terminals.
+func interactive() bool {
+	if noTUI {
+		return false
+	}
+	return isTerminal(os.Stdin) && isTerminal(humanOutput())
+}
+
+// plainOutput returns where plain runs print their progress, or nil to use
+// the TUI.
+func plainOutput(tui bool) io.Writer {
+	if tui {
+		return nil
+	}
+	return humanOutput()
+}
+
+// runModel runs the steps of m. In plain mode there is no renderer nor
+// keyboard input, so SIGINT and SIGTERM become an immediate abort.
+func runModel(m *setupModel) error {
+	if m.plain == nil {
+		_, err := tea.NewProgram(m, tea.WithOutput(humanOutput())).Run()
+		return err
+	}
+	p := tea.NewProgram(m, tea.WithoutRenderer(), tea.WithInput(nil), tea.WithoutSignalHandler())
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-sig:
+				p.Send(interruptMsg{})
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	_, err := p.Run()
+	return err
+}
@@ -0,0 +1,505 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"paisanos-cli/cmd/action"
+	"paisanos-cli/cmd/catalog"
+	"paisanos-cli/cmd/executor"
+	"paisanos-cli/cmd/probe"
+	"paisanos-cli/cmd/state"
+)
+
+// Output formats accepted by --format in dry-run mode.
+const (
+	formatTable  = "table"
+	formatJSON   = "json"
+	formatScript = "script"
+)
+
+var planFormats = []string{formatTable, formatJSON, formatScript}
+
+// plan is the ordered list of steps a setup run executes, together with
+// the packages skipped because they are already installed.
+type plan struct {
+	steps         []step
+	skipped       []catalog.Package
+	incompatible  []versionMismatch // installed, but no upgrade meets their constraint
+	brewInstalled bool
+}
+
+// versionMismatch is an installed package whose version does not meet the
+// constraint of its catalog entry.
+type versionMismatch struct {
+	pkg       catalog.Package
+	installed string
+}
+
+// String describes the mismatch, e.g. "fnm 1.38.1 no cumple <1.38".
+func (v versionMismatch) String() string {
+	return fmt.Sprintf("%s %s no cumple %s", v.pkg.Name, v.installed, v.pkg.Version)
+}
+
+// Step IDs of the Homebrew steps every package install depends on.
+const (
+	stepBrewInstall  = "brew:install"
+	stepBrewProfile  = "brew:profile"
+	stepBrewShellenv = "brew:shellenv"
+	stepBrewUpdate   = "brew:update"
+)
+
+// stepMasInstall is the step ID of the formula of the App Store CLI, which
+// mas packages need.
+const stepMasInstall = "formula:mas"
+
+// buildPlan creates the steps needed to add taps and install packages,
+// skipping the packages found installed. Installed packages older than
+// their version constraint are upgraded instead, and the ones newer than
+// it are left alone and listed as incompatible, since Homebrew cannot
+// downgrade them. When Homebrew is missing the bootstrap steps are
+// prepended.
+//
+// Package installs only depend on Homebrew being ready and on their own
+// before hooks, so they can run concurrently. Homebrew is updated once up
+// front and the installs run with auto-update disabled, otherwise parallel
+// installs fight over the update lock. Taps are added right after the
+// update, before any install. Mas apps also wait for the mas formula when it
+// is installed in the same run. Pinned formulae are pinned right after their
+// install or upgrade.
+func buildPlan(ex executor.Executor, packages []catalog.Package, taps []string, found detection, profilePath string) plan {
+	var p plan
+
+	// Check if Homebrew is installed.
+	var brewDeps []string
+	if _, err := ex.LookPath("brew"); err != nil {
+		p.steps = append(p.steps, brewBootstrapSteps(profilePath)...)
+		brewDeps = []string{stepBrewShellenv}
+	} else {
+		p.brewInstalled = true
+	}
+
+	var tapSteps, installs []step
+	for _, tap := range taps {
+		tapSteps = append(tapSteps, step{
+			id:          "tap:" + tap,
+			description: fmt.Sprintf("Agregando el tap %s...", tap),
+			command:     "brew",
+			args:        []string{"tap", tap},
+			env:         []string{"HOMEBREW_NO_AUTO_UPDATE=1"},
+			deps:        []string{stepBrewUpdate},
+			retry:       brewRetry,
+			estimate:    5 * time.Second,
+		})
+	}
+	ready := []string{stepBrewUpdate}
+	if len(tapSteps) > 0 {
+		ready = nil
+		for _, s := range tapSteps {
+			ready = append(ready, s.id)
+		}
+	}
+
+	// Formulae are installed before casks and App Store apps, each group in
+	// catalog order.
+	for _, kind := range []catalog.Kind{catalog.KindFormula, catalog.KindCask, catalog.KindMas} {
+		for _, pkg := range packages {
+			if pkg.Kind != kind {
+				continue
+			}
+			deps := ready
+			if kind == catalog.KindMas && slices.ContainsFunc(installs, func(s step) bool { return s.id == stepMasInstall }) {
+				deps = append(slices.Clone(ready), stepMasInstall)
+			}
+			if found.installed[pkg.Name] {
+				switch v := found.versions[pkg.Name]; v.Status {
+				case probe.VersionOutdated:
+					// brew upgrade skips pinned formulae, so unpin first.
+					s := upgradeStep(pkg, v.Installed)
+					s.deps = deps
+					var unpin []step
+					if pkg.Pin {
+						unpin = []step{pinStep(pkg, false, deps)}
+						s.deps = []string{unpin[0].id}
+					}
+					installs = slices.Concat(installs, unpin, []step{s}, pinSteps(pkg, s.id))
+				case probe.VersionIncompatible:
+					p.incompatible = append(p.incompatible, versionMismatch{pkg: pkg, installed: v.Installed})
+				default:
+					// Already installed within its constraint, but maybe
+					// not pinned yet.
+					p.skipped = append(p.skipped, pkg)
+					if pkg.Pin {
+						installs = append(installs, pinStep(pkg, true, deps))
+					}
+				}
+				continue
+			}
+			// Package hooks run right before and after its install.
+			hookID := "hook:" + packageStepID(pkg)
+			before := hookSteps(hookID+":before", pkg.Before, deps)
+			s := installStep(pkg)
+			s.deps = deps
+			if len(before) > 0 {
+				s.deps = []string{before[len(before)-1].id}
+			}
+			after := hookSteps(hookID+":after", pkg.After, []string{s.id})
+			installs = slices.Concat(installs, before, []step{s}, pinSteps(pkg, s.id), after)
+		}
+	}
+
+	if len(installs) > 0 || len(tapSteps) > 0 {
+		p.steps = append(p.steps, step{
+			id:          stepBrewUpdate,
+			description: "Actualizando Homebrew...",
+			command:     "brew",
+			args:        []string{"update"},
+			deps:        brewDeps,
+			retry:       brewRetry,
+			estimate:    30 * time.Second,
+		})
+		p.steps = slices.Concat(p.steps, tapSteps, installs)
+	}
+	p.setBrewPath()
+	return p
+}
+
+// setBrewPath sets brewPath on the command steps that run after this run
+// installs Homebrew: the shellenv step cannot change the environment of
+// paisanos, so brew and what it installs are only found through brewPath.
+func (p plan) setBrewPath() {
+	if p.brewInstalled {
+		return
+	}
+	for i := range p.steps {
+		s := &p.steps[i]
+		if s.command != "" && !isBrewBootstrap(s.id) && !strings.HasPrefix(s.id, stepHookBefore+":") {
+			s.brewPath = true
+		}
+	}
+}
+
+// isBrewBootstrap reports whether id is one of brewBootstrapSteps.
+func isBrewBootstrap(id string) bool {
+	return id == stepBrewInstall || id == stepBrewProfile || id == stepBrewShellenv
+}
+
+// setDefaultTimeout sets timeout on the steps that do not declare their own.
+func (p plan) setDefaultTimeout(timeout time.Duration) {
+	for i := range p.steps {
+		if p.steps[i].timeout == 0 {
+			p.steps[i].timeout = timeout
+		}
+	}
+}
+
+// withoutCompleted returns the plan without the steps that st records as
+// done, together with the removed steps.
+func (p plan) withoutCompleted(st *state.State) (plan, []step) {
+	var completed []step
+	remaining := p.steps[:0:0]
+	for _, s := range p.steps {
+		if st.Done(s.id) {
+			completed = append(completed, s)
+			continue
+		}
+		remaining = append(remaining, s)
+	}
+	p.steps = remaining
+	return p, completed
+}
+
+// brewBootstrapSteps returns the steps that install and configure Homebrew.
+func brewBootstrapSteps(profilePath string) []step {
+	return []step{
+		{
+			id:          stepBrewInstall,
+			description: "Instalando Homebrew...",
+			command:     "/bin/bash",
+			args: []string{
+				"-c",
+				"$(curl -fsSL https://raw.githubusercontent.com/Homebrew/install/HEAD/install.sh)",
+			},
+			env:        []string{"NONINTERACTIVE=1"},
+			retry:      brewRetry,
+			estimate:   3 * time.Minute,
+			privileged: true,
+		},
+		{
+			id:          stepBrewProfile,
+			description: "Configurando Homebrew...",
+			action: action.AppendFile{
+				Path:    profilePath,
+				Content: `eval "$(/opt/homebrew/bin/brew shellenv)"`,
+			},
+			deps: []string{stepBrewInstall},
+		},
+		{
+			id:          stepBrewShellenv,
+			description: "Evaluando entorno de Homebrew...",
+			command:     "/bin/bash",
+			args:        []string{"-c", `eval "$(/opt/homebrew/bin/brew shellenv)"`},
+			deps:        []string{stepBrewProfile},
+			estimate:    time.Second,
+		},
+	}
+}
+
+// installStep returns the brew step that installs pkg, or the mas step of
+// an App Store app.
+func installStep(pkg catalog.Package) step {
+	command, args := "brew", []string{"install", pkg.Name}
+	env := []string{"HOMEBREW_NO_AUTO_UPDATE=1"}
+	switch pkg.Kind {
+	case catalog.KindCask:
+		args = []string{"install", "--cask", pkg.Name}
+	case catalog.KindMas:
+		command, args, env = "mas", []string{"install", strconv.FormatInt(pkg.ID, 10)}, nil
+	}
+	return step{
+		id:          packageStepID(pkg),
+		description: installingDescription(pkg.Name),
+		command:     command,
+		args:        args,
+		env:         env,
+		pkg:         pkg.Name,
+		retry:       brewRetry.withOverrides(pkg.Retry),
+		timeout:     pkg.TimeoutDuration(),
+		estimate:    pkg.EstimateDuration(),
+		verify:      pkg.Verify,
+		kind:        pkg.Kind,
+		version:     pkg.Version,
+		privileged:  pkg.Privileged,
+	}
+}
+
+// upgradeStep returns the brew step that upgrades pkg, whose installed
+// version is older than its constraint allows.
+func upgradeStep(pkg catalog.Package, installed string) step {
+	s := installStep(pkg)
+	s.args[0] = "upgrade"
+	s.description = fmt.Sprintf("Actualizando %s (%s no cumple %s)...", pkg.Name, installed, pkg.Version)
+	s.upgrade = true
+	return s
+}
+
+// pinSteps returns the step that pins pkg after the step id, if the catalog
+// pins it.
+func pinSteps(pkg catalog.Package, id string) []step {
+	if !pkg.Pin {
+		return nil
+	}
+	return []step{pinStep(pkg, true, []string{id})}
+}
+
+// pinStep returns the step that runs `brew pin`, or `brew unpin`, on pkg.
+// Both only warn when the formula already is in that state.
+func pinStep(pkg catalog.Package, pin bool, deps []string) step {
+	command, description := "pin", "Fijando la versión de %s..."
+	if !pin {
+		command, description = "unpin", "Liberando la versión de %s..."
+	}
+	return step{
+		id:          command + ":" + packageStepID(pkg),
+		description: fmt.Sprintf(description, pkg.Name),
+		command:     "brew",
+		args:        []string{command, pkg.Name},
+		env:         []string{"HOMEBREW_NO_AUTO_UPDATE=1"},
+		deps:        deps,
+		retry:       brewRetry,
+		estimate:    2 * time.Second,
+	}
+}
+
+// packageStepID returns the stable step ID of a package install.
+func packageStepID(pkg catalog.Package) string {
+	return string(pkg.Kind) + ":" + pkg.Name
+}
+
+// printPlan writes the plan to w in the given format. The JSON format is
+// the report of the run, with every step pending.
+func printPlan(w io.Writer, p plan, format string, report *setupReport) error {
+	switch format {
+	case formatTable:
+		return printPlanTable(w, p)
+	case formatJSON:
+		return writeReport(w, report)
+	case formatScript:
+		return printPlanScript(w, p)
+	}
+	return fmt.Errorf("unknown format %q (table, json or script)", format)
+}
+
+func printPlanTable(w io.Writer, p plan) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tPASO\tCOMANDO")
+	for i, s := range p.steps {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", i+1, s.description, s.commandLine())
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if len(p.steps) == 0 {
+		fmt.Fprintln(w, "No hay pasos para ejecutar.")
+	}
+	for _, pkg := range p.skipped {
+		fmt.Fprintf(w, "■ %s ya se encuentra instalado, se omite.\n", pkg.Name)
+	}
+	for _, v := range p.incompatible {
+		fmt.Fprintf(w, "⚠ %s: versión incompatible, se omite.\n", v)
+	}
+	return nil
+}
+
+func printPlanScript(w io.Writer, p plan) error {
+	var b strings.Builder
+	b.WriteString("#!/bin/bash\n")
+	b.WriteString("# Plan generado por paisanos setup --dry-run.\n")
+	b.WriteString("set -euo pipefail\n")
+	for _, pkg := range p.skipped {
+		fmt.Fprintf(&b, "\n# Omitido: %s ya se encuentra instalado.\n", pkg.Name)
+	}
+	for _, v := range p.incompatible {
+		fmt.Fprintf(&b, "\n# Omitido: %s (versión incompatible).\n", v)
+	}
+	for i, s := range p.steps {
+		fmt.Fprintf(&b, "\n# %d. %s\n", i+1, s.description)
+		warning := fmt.Sprintf("echo %s >&2", shellQuote(fmt.Sprintf("aviso: falló el paso %d, se continúa.", i+1)))
+		switch {
+		case s.action != nil && s.warn:
+			// errexit is ignored on the left of ||, so the subshell keeps
+			// it by running on its own.
+			fmt.Fprintf(&b, "set +e\n(\nset -e\n%s)\nif (( $? != 0 )); then %s; fi\nset -e\n", actionScript(s.action), warning)
+		case s.action != nil:
+			b.WriteString(actionScript(s.action))
+		case s.id == stepBrewShellenv:
+			// Unlike paisanos, the script can load it for the later steps.
+			fmt.Fprintf(&b, "%s\n", s.args[len(s.args)-1])
+		case s.warn:
+			fmt.Fprintf(&b, "%s || %s\n", s.commandLine(), warning)
+		default:
+			fmt.Fprintf(&b, "%s\n", s.commandLine())
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// actionScript returns the shell commands equivalent to a native action,
+// which apply it only when needed like the action does, one per line.
+func actionScript(a executor.Action) string {
+	var b strings.Builder
+	mkdirParent := func(path string) {
+		fmt.Fprintf(&b, "mkdir -p %s\n", shellPath(filepath.Dir(path)))
+	}
+	writeFile := func(path string, content []byte, mode fs.FileMode) {
+		mkdirParent(path)
+		fmt.Fprintf(&b, "printf '%%s' %s > %s\n", shellQuote(string(content)), shellPath(path))
+		fmt.Fprintf(&b, "chmod %o %s\n", fileMode(mode), shellPath(path))
+	}
+	switch a := a.(type) {
+	case action.WriteFile:
+		writeFile(a.Path, []byte(a.Content), a.Mode)
+	case action.Template:
+		// Rendered now, for this user and machine.
+		content, err := a.Render()
+		if err != nil {
+			fmt.Fprintf(&b, "# No se pudo generar %s: %v\nexit 1\n", a.Path, err)
+			break
+		}
+		writeFile(a.Path, content, a.Mode)
+	case action.AppendFile:
+		path, content := shellPath(a.Path), strings.TrimSuffix(a.Content, "\n")
+		fmt.Fprintf(&b, "if [[ \"$(cat %s 2>/dev/null)\" != *%s* ]]; then\n", path, shellQuote(content))
+		b.WriteString("  ")
+		mkdirParent(a.Path)
+		fmt.Fprintf(&b, "  if [[ -s %s && -n \"$(tail -c 1 %s)\" ]]; then echo >> %s; fi\n", path, path, path)
+		fmt.Fprintf(&b, "  printf '%%s\\n' %s >> %s\n", shellQuote(content), path)
+		b.WriteString("fi\n")
+	case action.Symlink:
+		path := shellPath(a.Path)
+		fmt.Fprintf(&b, "if [[ -e %s && ! -L %s ]]; then echo %s >&2; exit 1; fi\n", path, path, shellQuote(a.Path+" ya existe y no es un symlink"))
+		mkdirParent(a.Path)
+		fmt.Fprintf(&b, "ln -sfn %s %s\n", shellPath(a.Target), path)
+	case action.Download:
+		path, tmp := shellPath(a.Path), shellPath(a.Path+".tmp")
+		mkdirParent(a.Path)
+		fmt.Fprintf(&b, "curl -fsSL -o %s %s\n", tmp, shellQuote(a.URL))
+		fmt.Fprintf(&b, "printf '%%s  %%s\\n' %s %s | shasum -a 256 -c -\n", strings.ToLower(a.SHA256), tmp)
+		fmt.Fprintf(&b, "chmod %o %s\n", fileMode(a.Mode), tmp)
+		fmt.Fprintf(&b, "mv %s %s\n", tmp, path)
+	case action.Mkdir:
+		mode := a.Mode
+		if mode == 0 {
+			mode = action.DefaultDirMode
+		}
+		fmt.Fprintf(&b, "mkdir -p -m %o %s\n", mode, shellPath(a.Path))
+	default:
+		fmt.Fprintf(&b, "# Paso nativo de paisanos, sin equivalente en shell: %s\n", a)
+	}
+	return b.String()
+}
+
+// fileMode returns mode, or action.DefaultFileMode when it is zero.
+func fileMode(mode fs.FileMode) fs.FileMode {
+	if mode == 0 {
+		return action.DefaultFileMode
+	}
+	return mode
+}
+
+// shellPath quotes path for a POSIX shell, keeping a leading "~" as $HOME
+// so the script works for whoever runs it.
+func shellPath(path string) string {
+	if path == "~" {
+		return `"$HOME"`
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		return `"$HOME"/` + shellQuote(rest)
+	}
+	return shellQuote(path)
+}
+
+// durationString formats d, or returns "" when it is zero.
+func durationString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// commandLine renders the step as a shell command line, or describes its
+// native action.
+func (s step) commandLine() string {
+	if s.action != nil {
+		return s.action.String()
+	}
+	parts := make([]string, 0, len(s.env)+len(s.args)+1)
+	for _, e := range s.env {
+		k, v, _ := strings.Cut(e, "=")
+		parts = append(parts, k+"="+shellQuote(v))
+	}
+	parts = append(parts, shellQuote(s.command))
+	for _, a := range s.args {
+		parts = append(parts, shellQuote(a))
+	}
+	return strings.Join(parts, " ")
+}
+
+// shellQuote quotes s for a POSIX shell when needed.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if !strings.ContainsAny(s, " \t\n\"'`$\\|&;<>()*?[]#~!{}") {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
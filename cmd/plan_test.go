@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"paisanos-cli/cmd/action"
+	"paisanos-cli/cmd/catalog"
+	"paisanos-cli/cmd/executor"
+	"paisanos-cli/cmd/probe"
+)
+
+// stepIDs returns the IDs of the steps of p, in order.
+func stepIDs(p plan) []string {
+	ids := make([]string, len(p.steps))
+	for i, s := range p.steps {
+		ids[i] = s.id
+	}
+	return ids
+}
+
+func TestBuildPlanVersions(t *testing.T) {
+	node := catalog.Package{Name: "node@20", Kind: catalog.KindFormula, Version: ">=20.11 <21", Pin: true}
+	tests := []struct {
+		name  string
+		check probe.VersionCheck
+		want  []string
+	}{
+		{
+			name:  "within constraint",
+			check: probe.VersionCheck{Status: probe.VersionOK, Installed: "20.11.1"},
+			want:  []string{stepBrewUpdate, "pin:formula:node@20"},
+		},
+		{
+			name:  "outdated",
+			check: probe.VersionCheck{Status: probe.VersionOutdated, Installed: "20.9.0"},
+			want:  []string{stepBrewUpdate, "unpin:formula:node@20", "formula:node@20", "pin:formula:node@20"},
+		},
+		{
+			name:  "incompatible",
+			check: probe.VersionCheck{Status: probe.VersionIncompatible, Installed: "22.1.0"},
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex := executor.NewFake().SetPath("brew", "/opt/homebrew/bin/brew")
+			found := detection{
+				installed: map[string]bool{node.Name: true},
+				versions:  map[string]probe.VersionCheck{node.Name: tt.check},
+			}
+			p := buildPlan(ex, []catalog.Package{node}, nil, found, "")
+			if got := stepIDs(p); !slices.Equal(got, tt.want) {
+				t.Errorf("steps = %q, want %q", got, tt.want)
+			}
+			for _, s := range p.steps {
+				if s.id == "formula:node@20" && (!s.upgrade || s.args[0] != "upgrade") {
+					t.Errorf("node step %q is not an upgrade", s.commandLine())
+				}
+			}
+		})
+	}
+}
+
+func TestActionScript(t *testing.T) {
+	tests := []struct {
+		action executor.Action
+		want   string
+	}{
+		{
+			action.AppendFile{Path: "/Users/ana/.zprofile", Content: `eval "$(/opt/homebrew/bin/brew shellenv)"`},
+			`if [[ "$(cat /Users/ana/.zprofile 2>/dev/null)" != *'eval "$(/opt/homebrew/bin/brew shellenv)"'* ]]; then
+  mkdir -p /Users/ana
+  if [[ -s /Users/ana/.zprofile && -n "$(tail -c 1 /Users/ana/.zprofile)" ]]; then echo >> /Users/ana/.zprofile; fi
+  printf '%s\n' 'eval "$(/opt/homebrew/bin/brew shellenv)"' >> /Users/ana/.zprofile
+fi
+`,
+		},
+		{
+			action.WriteFile{Path: "~/.npmrc", Content: "save-exact=true\n", Mode: 0o600},
+			`mkdir -p "$HOME"
+printf '%s' 'save-exact=true
+' > "$HOME"/.npmrc
+chmod 600 "$HOME"/.npmrc
+`,
+		},
+		{
+			action.Symlink{Path: "~/bin/code", Target: "/Applications/Visual Studio Code.app/Contents/Resources/app/bin/code"},
+			`if [[ -e "$HOME"/bin/code && ! -L "$HOME"/bin/code ]]; then echo '~/bin/code ya existe y no es un symlink' >&2; exit 1; fi
+mkdir -p "$HOME"/bin
+ln -sfn '/Applications/Visual Studio Code.app/Contents/Resources/app/bin/code' "$HOME"/bin/code
+`,
+		},
+		{
+			action.Mkdir{Path: "~/Code"},
+			"mkdir -p -m 755 \"$HOME\"/Code\n",
+		},
+	}
+	for _, tt := range tests {
+		if got := actionScript(tt.action); got != tt.want {
+			t.Errorf("actionScript(%s) =\n%s\nwant\n%s", tt.action, got, tt.want)
+		}
+	}
+}
+
+func TestBuildPlanBrewPath(t *testing.T) {
+	fnm := catalog.Package{Name: "fnm", Kind: catalog.KindFormula}
+	p := buildPlan(executor.NewFake(), []catalog.Package{fnm}, nil, detection{}, "/Users/ana/.zprofile")
+	want := []string{stepBrewInstall, stepBrewProfile, stepBrewShellenv, stepBrewUpdate, "formula:fnm"}
+	if got := stepIDs(p); !slices.Equal(got, want) {
+		t.Fatalf("steps = %q, want %q", got, want)
+	}
+	for _, s := range p.steps {
+		env := s.execCommand().Env
+		hasPath := slices.ContainsFunc(env, func(e string) bool { return strings.HasPrefix(e, "PATH=/opt/homebrew/bin:/usr/local/bin:") })
+		if bootstrap := isBrewBootstrap(s.id); hasPath == bootstrap {
+			t.Errorf("%s: env %q, want brew PATH %v", s.id, env, !bootstrap)
+		}
+	}
+
+	// After hooks run once Homebrew is installed, before hooks before.
+	hooks := p.withHooks([]catalog.Hook{{Run: "true"}}, []catalog.Hook{{Run: "fnm --version"}})
+	if first, last := hooks.steps[0], hooks.steps[len(hooks.steps)-1]; first.brewPath || !last.brewPath {
+		t.Errorf("brewPath = %v on %s and %v on %s, want false and true", first.brewPath, first.id, last.brewPath, last.id)
+	}
+
+	// With Homebrew already on PATH, no step changes it.
+	ex := executor.NewFake().SetPath("brew", "/opt/homebrew/bin/brew")
+	for _, s := range buildPlan(ex, []catalog.Package{fnm}, nil, detection{}, "").steps {
+		if s.brewPath {
+			t.Errorf("%s: brewPath with Homebrew installed", s.id)
+		}
+	}
+}
+
+func TestPlanScriptWarn(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found")
+	}
+	home := t.TempDir()
+	if err := os.WriteFile(filepath.Join(home, "code"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p := plan{brewInstalled: true}.withHooks(
+		[]catalog.Hook{
+			{Run: "false", OnFailure: catalog.HookWarn},
+			{Type: catalog.HookSymlink, Path: "~/code", Target: "/bin", OnFailure: catalog.HookWarn},
+		},
+		[]catalog.Hook{{Run: `touch "$HOME/done"`}},
+	)
+	var script bytes.Buffer
+	if err := printPlanScript(&script, p); err != nil {
+		t.Fatal(err)
+	}
+
+	// Warn steps print a warning and the script goes on.
+	cmd := exec.Command(bash, "-c", script.String())
+	cmd.Env = append(os.Environ(), "HOME="+home)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("script: %v\n%s\n%s", err, stderr.String(), script.String())
+	}
+	for _, want := range []string{"aviso: falló el paso 1", "aviso: falló el paso 2"} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("stderr = %q, want %q", stderr.String(), want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(home, "done")); err != nil {
+		t.Errorf("after hook did not run: %v", err)
+	}
+}
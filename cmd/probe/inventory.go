@@ -0,0 +1,98 @@
+package probe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+
+	"paisanos-cli/cmd/catalog"
+	"paisanos-cli/cmd/executor"
+)
+
+// Inventory is a snapshot of the installed Homebrew formulae and casks,
+// mapping every name to its installed versions.
+type Inventory struct {
+	Formulae map[string][]string
+	Casks    map[string][]string
+}
+
+// LoadInventory lists the installed formulae and casks with a single
+// `brew list --versions` call per kind, both running at once.
+func LoadInventory(ctx context.Context, ex executor.Executor) (*Inventory, error) {
+	inv := &Inventory{}
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() (err error) {
+		inv.Formulae, err = listVersions(ctx, ex, "--formula")
+		return err
+	})
+	g.Go(func() (err error) {
+		inv.Casks, err = listVersions(ctx, ex, "--cask")
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// HasFormula reports whether the formula name is installed. brew list
+// drops the tap of names like "user/tap/name".
+func (inv *Inventory) HasFormula(name string) bool {
+	_, ok := inv.Formulae[path.Base(name)]
+	return ok
+}
+
+// HasCask reports whether the cask name is installed.
+func (inv *Inventory) HasCask(name string) bool {
+	_, ok := inv.Casks[path.Base(name)]
+	return ok
+}
+
+// Versions returns the installed versions of the formula or cask name.
+func (inv *Inventory) Versions(kind catalog.Kind, name string) []string {
+	if kind == catalog.KindCask {
+		return inv.Casks[path.Base(name)]
+	}
+	return inv.Formulae[path.Base(name)]
+}
+
+// listVersions runs `brew list <kind> --versions` and parses its lines,
+// e.g. "python@3.12 3.12.1 3.12.2".
+func listVersions(ctx context.Context, ex executor.Executor, kind string) (map[string][]string, error) {
+	var out bytes.Buffer
+	cmd := executor.Command{Name: "brew", Args: []string{"list", kind, "--versions"}}
+	if err := ex.Run(ctx, cmd, &out); err != nil {
+		return nil, fmt.Errorf("%s: %w", cmd, err)
+	}
+	versions := make(map[string][]string)
+	sc := bufio.NewScanner(&out)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		versions[fields[0]] = fields[1:]
+	}
+	return versions, sc.Err()
+}
+
+// DetectAll runs probes concurrently, at most limit at a time, and reports
+// which of them detected their package.
+func DetectAll(ctx context.Context, env Env, probes []Probe, limit int) []bool {
+	found := make([]bool, len(probes))
+	var g errgroup.Group
+	g.SetLimit(max(limit, 1))
+	for i, p := range probes {
+		g.Go(func() error {
+			found[i] = p.Detect(ctx, env)
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return found
+}
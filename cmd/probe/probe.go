@@ -0,0 +1,208 @@
+// Package probe detects whether a package is already installed.
+//
+// A Probe is a single check (a Homebrew formula, an app bundle, a command
+// on PATH, ...). Probes combine with Any and All, and ForPackage builds the
+// probe of a catalog entry.
+package probe
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"paisanos-cli/cmd/action"
+	"paisanos-cli/cmd/catalog"
+	"paisanos-cli/cmd/executor"
+)
+
+// Env is the system probes inspect.
+type Env struct {
+	Exec executor.Executor
+	// Brew is a snapshot of the installed Homebrew packages shared by the
+	// formula and cask probes. When nil they run brew list themselves.
+	Brew *Inventory
+}
+
+// Probe detects an installed package.
+type Probe interface {
+	// Detect reports whether the probe finds the package in env.
+	Detect(ctx context.Context, env Env) bool
+	// String describes the probe, e.g. "brew list --cask slack".
+	String() string
+}
+
+// Formula detects a Homebrew formula.
+type Formula struct{ Name string }
+
+// Detect implements Probe.
+func (p Formula) Detect(ctx context.Context, env Env) bool {
+	if env.Brew != nil {
+		return env.Brew.HasFormula(p.Name)
+	}
+	return env.Exec.Probe(ctx, p.command())
+}
+
+func (p Formula) String() string { return p.command().String() }
+
+func (p Formula) command() executor.Command {
+	return executor.Command{Name: "brew", Args: []string{"list", p.Name}}
+}
+
+// Cask detects a Homebrew cask.
+type Cask struct{ Name string }
+
+// Detect implements Probe.
+func (p Cask) Detect(ctx context.Context, env Env) bool {
+	if env.Brew != nil {
+		return env.Brew.HasCask(p.Name)
+	}
+	return env.Exec.Probe(ctx, p.command())
+}
+
+func (p Cask) String() string { return p.command().String() }
+
+func (p Cask) command() executor.Command {
+	return executor.Command{Name: "brew", Args: []string{"list", "--cask", p.Name}}
+}
+
+// App detects an app bundle, e.g. /Applications/Google Chrome.app.
+type App struct{ Path string }
+
+// Detect implements Probe.
+func (p App) Detect(_ context.Context, env Env) bool {
+	return env.Exec.Exists(p.Path)
+}
+
+func (p App) String() string { return "app " + p.Path }
+
+// Command detects an executable on PATH.
+type Command struct{ Name string }
+
+// Detect implements Probe.
+func (p Command) Detect(_ context.Context, env Env) bool {
+	_, err := env.Exec.LookPath(p.Name)
+	return err == nil
+}
+
+func (p Command) String() string { return "command " + p.Name }
+
+// File detects any file or directory. A leading "~/" is expanded to the
+// home directory.
+type File struct{ Path string }
+
+// Detect implements Probe.
+func (p File) Detect(_ context.Context, env Env) bool {
+	return env.Exec.Exists(action.ExpandHome(p.Path))
+}
+
+func (p File) String() string { return "file " + p.Path }
+
+// Shell detects the package with a shell script that exits with 0 when it
+// is installed.
+type Shell struct{ Script string }
+
+// Detect implements Probe.
+func (p Shell) Detect(ctx context.Context, env Env) bool {
+	return env.Exec.Probe(ctx, executor.Command{Name: "/bin/bash", Args: []string{"-c", p.Script}})
+}
+
+func (p Shell) String() string { return "shell " + p.Script }
+
+// anyOf detects the package when one of its probes does.
+type anyOf []Probe
+
+// Any returns a probe that succeeds when any of probes succeeds. Probes run
+// in order and stop at the first success.
+func Any(probes ...Probe) Probe { return anyOf(probes) }
+
+// Detect implements Probe.
+func (a anyOf) Detect(ctx context.Context, env Env) bool {
+	for _, p := range a {
+		if p.Detect(ctx, env) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a anyOf) String() string { return join("any", a) }
+
+// allOf detects the package when every one of its probes does.
+type allOf []Probe
+
+// All returns a probe that succeeds when every one of probes succeeds.
+// Probes run in order and stop at the first failure.
+func All(probes ...Probe) Probe { return allOf(probes) }
+
+// Detect implements Probe.
+func (a allOf) Detect(ctx context.Context, env Env) bool {
+	for _, p := range a {
+		if !p.Detect(ctx, env) {
+			return false
+		}
+	}
+	return len(a) > 0
+}
+
+func (a allOf) String() string { return join("all", a) }
+
+func join(op string, probes []Probe) string {
+	parts := make([]string, len(probes))
+	for i, p := range probes {
+		parts[i] = p.String()
+	}
+	return fmt.Sprintf("%s(%s)", op, strings.Join(parts, ", "))
+}
+
+// FromCatalog returns the probe described by a catalog probe of pkg.
+func FromCatalog(pkg catalog.Package, p catalog.Probe) (Probe, error) {
+	name := p.Name
+	if name == "" {
+		name = pkg.Name
+	}
+	switch p.Type {
+	case catalog.ProbeFormula:
+		return Formula{Name: name}, nil
+	case catalog.ProbeCask:
+		return Cask{Name: name}, nil
+	case catalog.ProbeApp:
+		return App{Path: p.Path}, nil
+	case catalog.ProbeCommand:
+		return Command{Name: name}, nil
+	case catalog.ProbeFile:
+		return File{Path: p.Path}, nil
+	case catalog.ProbeShell:
+		return Shell{Script: p.Run}, nil
+	}
+	return nil, fmt.Errorf("unknown probe type %q", p.Type)
+}
+
+// ForPackage returns the probe that detects pkg: its declared probes,
+// combined as the package match says, or else the Homebrew probe of its
+// kind, which is always checked last. Mas packages have no Homebrew probe
+// and look for their app instead.
+func ForPackage(pkg catalog.Package) Probe {
+	var brew Probe
+	switch pkg.Kind {
+	case catalog.KindCask:
+		brew = Cask{Name: pkg.Name}
+	case catalog.KindMas:
+		brew = App{Path: pkg.AppPath()}
+	default:
+		brew = Formula{Name: pkg.Name}
+	}
+	if len(pkg.Probes) == 0 {
+		return brew
+	}
+	declared := make([]Probe, 0, len(pkg.Probes))
+	for _, cp := range pkg.Probes {
+		// Catalogs are validated when loaded, so unknown types never get here.
+		if p, err := FromCatalog(pkg, cp); err == nil {
+			declared = append(declared, p)
+		}
+	}
+	if pkg.Match == catalog.MatchAll {
+		return Any(All(declared...), brew)
+	}
+	return Any(append(declared, brew)...)
+}
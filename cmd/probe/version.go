@@ -0,0 +1,87 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"path"
+	"strings"
+
+	"paisanos-cli/cmd/catalog"
+	"paisanos-cli/cmd/executor"
+)
+
+// VersionStatus tells how the installed version of a package compares with
+// the version constraint of its catalog entry.
+type VersionStatus int
+
+const (
+	VersionOK           VersionStatus = iota // meets the constraint, or there is none
+	VersionOutdated                          // older than the constraint allows; brew upgrade may fix it
+	VersionIncompatible                      // newer than, or otherwise outside, the constraint
+)
+
+// VersionCheck is the result of CheckVersion.
+type VersionCheck struct {
+	Status    VersionStatus
+	Installed string // newest installed version, "" when unknown
+}
+
+// CheckVersion compares the newest version of pkg listed by
+// `brew list --versions` with its constraint. Packages without a version
+// in Homebrew, e.g. apps installed by hand and found by another probe,
+// are OK since there is nothing to compare.
+func CheckVersion(ctx context.Context, env Env, pkg catalog.Package) VersionCheck {
+	constraint := pkg.Constraint()
+	if constraint.IsZero() {
+		return VersionCheck{}
+	}
+	installed := InstalledVersion(ctx, env, pkg)
+	if installed == "" {
+		return VersionCheck{}
+	}
+	check := VersionCheck{Installed: installed}
+	switch ok, older := constraint.Check(installed); {
+	case ok:
+	case older:
+		check.Status = VersionOutdated
+	default:
+		check.Status = VersionIncompatible
+	}
+	return check
+}
+
+// InstalledVersion returns the newest installed version of the formula or
+// cask pkg, or "" when Homebrew does not list it.
+func InstalledVersion(ctx context.Context, env Env, pkg catalog.Package) string {
+	var versions []string
+	if env.Brew != nil {
+		versions = env.Brew.Versions(pkg.Kind, pkg.Name)
+	} else {
+		var out bytes.Buffer
+		if err := env.Exec.Run(ctx, VersionCommand(pkg), &out); err != nil {
+			return ""
+		}
+		for _, line := range strings.Split(out.String(), "\n") {
+			if fields := strings.Fields(line); len(fields) > 1 && fields[0] == path.Base(pkg.Name) {
+				versions = fields[1:]
+			}
+		}
+	}
+	newest := ""
+	for _, v := range versions {
+		if newest == "" || catalog.CompareVersions(v, newest) > 0 {
+			newest = v
+		}
+	}
+	return newest
+}
+
+// VersionCommand returns the command InstalledVersion runs without a
+// Homebrew snapshot, e.g. `brew list --versions node@20`.
+func VersionCommand(pkg catalog.Package) executor.Command {
+	args := []string{"list", "--versions", pkg.Name}
+	if pkg.Kind == catalog.KindCask {
+		args = []string{"list", "--cask", "--versions", pkg.Name}
+	}
+	return executor.Command{Name: "brew", Args: args}
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"paisanos-cli/cmd/catalog"
+	"paisanos-cli/cmd/executor"
+	"paisanos-cli/cmd/probe"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// probeConcurrency is the maximum number of probes running at once.
+const probeConcurrency = 8
+
+// errProbingCancelled is returned when the user quits while probing.
+var errProbingCancelled = errors.New("probing cancelled")
+
+// detection is what probing found, by package name: the installed
+// packages, and the version checks of the ones with a constraint.
+type detection struct {
+	installed map[string]bool
+	versions  map[string]probe.VersionCheck
+}
+
+// detectInstalled reports which packages are already installed, and
+// whether their versions meet the catalog constraints.
+// Homebrew is listed once and the snapshot is shared by every probe; the
+// remaining probes (apps, commands, scripts) run concurrently. Nothing is
+// probed when Homebrew itself is missing.
+func detectInstalled(ctx context.Context, ex executor.Executor, packages []catalog.Package) detection {
+	var d detection
+	if _, err := ex.LookPath("brew"); err != nil {
+		return d
+	}
+	env := probe.Env{Exec: ex}
+	// Without a snapshot the brew probes fall back to one brew list each.
+	if inv, err := probe.LoadInventory(ctx, ex); err == nil {
+		env.Brew = inv
+	}
+	probes := make([]probe.Probe, len(packages))
+	for i, pkg := range packages {
+		probes[i] = probe.ForPackage(pkg)
+	}
+	found := probe.DetectAll(ctx, env, probes, probeConcurrency)
+	d.installed = make(map[string]bool, len(packages))
+	d.versions = make(map[string]probe.VersionCheck)
+	for i, pkg := range packages {
+		d.installed[pkg.Name] = found[i]
+		if found[i] && pkg.Version != "" {
+			d.versions[pkg.Name] = probe.CheckVersion(ctx, env, pkg)
+		}
+	}
+	return d
+}
+
+// probesDoneMsg carries the result of detectInstalled.
+type probesDoneMsg struct {
+	found detection
+}
+
+// probingModel shows a spinner while the packages are probed.
+type probingModel struct {
+	spinner   spinner.Model
+	detect    func(ctx context.Context) detection
+	ctx       context.Context
+	cancel    context.CancelFunc
+	found     detection
+	cancelled bool
+	done      bool
+}
+
+func (m *probingModel) Init() tea.Cmd {
+	return tea.Batch(m.spinner.Tick, func() tea.Msg {
+		return probesDoneMsg{found: m.detect(m.ctx)}
+	})
+}
+
+func (m *probingModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case probesDoneMsg:
+		m.found = msg.found
+		m.done = true
+		return m, tea.Quit
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			m.cancelled = true
+			m.done = true
+			m.cancel()
+			return m, tea.Quit
+		}
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+func (m *probingModel) View() string {
+	if m.done {
+		return ""
+	}
+	return m.spinner.View() + " " + textStyle("Buscando paquetes instalados...") + "\n"
+}
+
+// probeWithSpinner runs detectInstalled showing a spinner on out.
+func probeWithSpinner(ex executor.Executor, packages []catalog.Package, out io.Writer) (detection, error) {
+	sp := spinner.New()
+	sp.Style = spinnerStyle
+	sp.Spinner = spinner.Line
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m := &probingModel{
+		spinner: sp,
+		detect: func(ctx context.Context) detection {
+			return detectInstalled(ctx, ex, packages)
+		},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if _, err := tea.NewProgram(m, tea.WithOutput(out)).Run(); err != nil {
+		return detection{}, err
+	}
+	if m.cancelled {
+		return detection{}, errProbingCancelled
+	}
+	return m.found, nil
+}
@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"paisanos-cli/cmd/state"
+
+	"github.com/charmbracelet/bubbles/progress"
+)
+
+// Estimates of the steps that neither ran on this machine nor declare one
+// in the catalog.
+const (
+	defaultEstimate = 10 * time.Second // commands, e.g. shell hooks
+	actionEstimate  = time.Second      // native actions, e.g. writing a file
+)
+
+// maxBarWidth is the width of the progress bar on wide terminals.
+const maxBarWidth = 40
+
+// newProgressBar returns the bar of the overall progress.
+func newProgressBar() progress.Model {
+	return progress.New(progress.WithDefaultGradient(), progress.WithWidth(maxBarWidth))
+}
+
+// stepEstimates returns how long each step is expected to take: its
+// average in previous runs on this machine, else its catalog estimate,
+// else a default by kind of step.
+func stepEstimates(steps []step, history *state.History) []time.Duration {
+	estimates := make([]time.Duration, len(steps))
+	for i, s := range steps {
+		if history != nil {
+			if d, ok := history.Estimate(s.id); ok {
+				estimates[i] = d
+				continue
+			}
+		}
+		switch {
+		case s.estimate > 0:
+			estimates[i] = s.estimate
+		case s.action != nil:
+			estimates[i] = actionEstimate
+		default:
+			estimates[i] = defaultEstimate
+		}
+	}
+	return estimates
+}
+
+// remaining returns the time left of each step at now: nothing for the
+// finished ones and, for the running ones, their estimate minus what they
+// already ran. A step running longer than expected is assumed to be about
+// to finish.
+func (m *setupModel) remaining(now time.Time) []time.Duration {
+	left := make([]time.Duration, len(m.steps))
+	for i := range m.steps {
+		switch m.status[i] {
+		case statusPending:
+			left[i] = m.estimates[i]
+		case statusRunning:
+			left[i] = max(m.estimates[i]-now.Sub(m.started[i]), 0)
+		}
+	}
+	return left
+}
+
+// eta estimates the time until every step finishes. It replays the
+// scheduler on the remaining steps: each one starts once its dependencies
+// finish and one of the jobs workers is free.
+func (m *setupModel) eta(now time.Time) time.Duration {
+	left := m.remaining(now)
+	finish := make([]time.Duration, len(m.steps))
+	workers := make([]time.Duration, m.jobs) // when each worker is free
+	w := 0
+	for i := range m.steps {
+		if m.status[i] == statusRunning && w < len(workers) {
+			finish[i] = left[i]
+			workers[w] = left[i]
+			w++
+		}
+	}
+	var end time.Duration
+	for i, s := range m.steps {
+		if m.status[i] == statusPending {
+			var ready time.Duration
+			for _, dep := range s.deps {
+				if j, ok := m.index[dep]; ok {
+					ready = max(ready, finish[j])
+				}
+			}
+			free := slices.Index(workers, slices.Min(workers))
+			finish[i] = max(ready, workers[free]) + left[i]
+			workers[free] = finish[i]
+		}
+		end = max(end, finish[i])
+	}
+	return end
+}
+
+// progressView renders the overall progress: a bar weighted by the step
+// estimates, the count of finished steps, the elapsed time and the ETA.
+func (m *setupModel) progressView() string {
+	now := time.Now()
+	var total, left time.Duration
+	finished := 0
+	for i, d := range m.remaining(now) {
+		total += m.estimates[i]
+		left += d
+		if m.status[i] != statusPending && m.status[i] != statusRunning {
+			finished++
+		}
+	}
+	percent := 1.0
+	if total > 0 {
+		percent = 1 - float64(left)/float64(total)
+	}
+	return fmt.Sprintf("%s  %d/%d %s\n",
+		m.bar.ViewAs(percent),
+		finished, len(m.steps),
+		helpStyle(fmt.Sprintf("· %s transcurrido · ~%s restante",
+			roundDuration(now.Sub(m.begin)), roundDuration(m.eta(now)))),
+	)
+}
+
+// roundDuration rounds d to seconds for display, e.g. 1m20s.
+func roundDuration(d time.Duration) time.Duration {
+	return d.Round(time.Second)
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	_ "embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Formats of --report, picked by the file extension.
+const (
+	reportMarkdown = "markdown"
+	reportHTML     = "html"
+)
+
+var (
+	//go:embed report.md.tmpl
+	reportMarkdownTemplate string
+	//go:embed report.html.tmpl
+	reportHTMLTemplate string
+)
+
+// reportFileFormat returns the format of the report written to path.
+func reportFileFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown":
+		return reportMarkdown, nil
+	case ".html", ".htm":
+		return reportHTML, nil
+	}
+	return "", fmt.Errorf("extensión de reporte desconocida %q (.md o .html)", filepath.Ext(path))
+}
+
+// writeReportFile renders r as a Markdown or HTML document into path.
+func writeReportFile(path string, r *setupReport) error {
+	format, err := reportFileFormat(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if format == reportHTML {
+		err = renderReportHTML(f, r)
+	} else {
+		err = renderReportMarkdown(f, r)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// saveReport writes r to --report, if set, and tells where it is.
+func saveReport(out io.Writer, r *setupReport) {
+	if reportPath == "" {
+		return
+	}
+	if err := writeReportFile(reportPath, r); err != nil {
+		fmt.Fprintln(out, failed(fmt.Sprintf("No se pudo guardar el reporte: %v", err)))
+		return
+	}
+	fmt.Fprintln(out, helpStyle(fmt.Sprintf("Reporte guardado en %s", reportPath)))
+}
+
+// reportFuncs are the helpers both report templates use.
+var reportFuncs = map[string]any{
+	"runLabel":  runLabel,
+	"stepLabel": stepLabel,
+	"seconds":   secondsString,
+	"date":      func(t time.Time) string { return t.Local().Format("2006-01-02 15:04:05") },
+	"join":      strings.Join,
+}
+
+func renderReportMarkdown(w io.Writer, r *setupReport) error {
+	funcs := template.FuncMap(maps.Clone(reportFuncs))
+	funcs["cell"] = markdownCell
+	t, err := template.New("report").Funcs(funcs).Parse(reportMarkdownTemplate)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, r)
+}
+
+func renderReportHTML(w io.Writer, r *setupReport) error {
+	t, err := htmltemplate.New("report").Funcs(htmltemplate.FuncMap(reportFuncs)).Parse(reportHTMLTemplate)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, r)
+}
+
+// Packages returns the package installs of the report.
+func (r *setupReport) Packages() []stepReport {
+	var out []stepReport
+	for _, s := range r.Steps {
+		if s.Package != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// OtherSteps returns the steps that install no package: Homebrew and hooks.
+func (r *setupReport) OtherSteps() []stepReport {
+	var out []stepReport
+	for _, s := range r.Steps {
+		if s.Package == "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Problems returns the steps that failed, warned or never finished.
+func (r *setupReport) Problems() []stepReport {
+	var out []stepReport
+	for _, s := range r.Steps {
+		switch s.Status {
+		case reportStepFailed, reportStepWarned, reportStepSkipped, reportStepCancelled, reportStepIncompatible:
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Caveats returns the steps whose install printed Homebrew caveats.
+func (r *setupReport) Caveats() []stepReport {
+	var out []stepReport
+	for _, s := range r.Steps {
+		if s.Caveats != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Duration returns how long the run took.
+func (r *setupReport) Duration() string {
+	if r.FinishedAt.IsZero() {
+		return ""
+	}
+	return roundDuration(r.FinishedAt.Sub(r.StartedAt)).String()
+}
+
+// runLabel returns the Spanish label of a report status.
+func runLabel(status string) string {
+	switch status {
+	case reportPlanned:
+		return "planificado (dry-run)"
+	case reportSuccess:
+		return "completado correctamente"
+	case reportFailed:
+		return "terminó con errores"
+	case reportAborted:
+		return "interrumpido"
+	}
+	return status
+}
+
+// stepLabel returns the Spanish label of a step status, matching the
+// summary table.
+func stepLabel(s stepReport) string {
+	switch s.Status {
+	case reportStepDone:
+		if s.Upgrade {
+			return resultUpgraded
+		}
+		if s.Package != "" {
+			return resultInstalled
+		}
+		return resultCompleted
+	case reportStepWarned:
+		return resultWarned
+	case reportStepPresent:
+		return resultPresent
+	case reportStepFailed:
+		return resultFailed
+	case reportStepSkipped:
+		return resultSkipped
+	case reportStepCancelled:
+		return resultCancelled
+	case reportStepResumed:
+		return "completado en una ejecución anterior"
+	case reportStepIncompatible:
+		return resultIncompatible
+	}
+	return "pendiente"
+}
+
+// secondsString formats a duration in seconds, e.g. 1m20s, or returns ""
+// when it is zero.
+func secondsString(seconds float64) string {
+	return durationString(roundDuration(time.Duration(seconds * float64(time.Second))))
+}
+
+// markdownCell escapes s for a Markdown table cell.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// brewCaveats returns the "==> Caveats" section of Homebrew output, if any.
+func brewCaveats(output []byte) string {
+	var b strings.Builder
+	in := false
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "==> ") {
+			in = strings.TrimSpace(line) == "==> Caveats"
+			continue
+		}
+		if in {
+			b.WriteString(line + "\n")
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/user"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+
+	"paisanos-cli/cmd/catalog"
+	"paisanos-cli/cmd/executor"
+	"paisanos-cli/cmd/probe"
+)
+
+// Output formats accepted by --output.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+var outputFormats = []string{outputText, outputJSON}
+
+// Run statuses of a setupReport.
+const (
+	reportPlanned = "planned" // dry-run, nothing was executed
+	reportSuccess = "success"
+	reportFailed  = "failed"
+	reportAborted = "aborted"
+)
+
+// Step statuses of a setupReport.
+const (
+	reportStepPending      = "pending" // dry-run, or never started
+	reportStepDone         = "done"
+	reportStepFailed       = "failed"
+	reportStepWarned       = "warned"       // failed, but the step only warns
+	reportStepSkipped      = "skipped"      // a dependency failed
+	reportStepCancelled    = "cancelled"    // killed by an abort
+	reportStepPresent      = "present"      // the package was already installed
+	reportStepResumed      = "resumed"      // completed by a previous run
+	reportStepIncompatible = "incompatible" // installed with a version outside its constraint
+)
+
+// setupReport is the machine-readable outcome of a setup run, printed by
+// --output json. Dry-run prints the same document with every step pending.
+type setupReport struct {
+	Version         string       `json:"version"`
+	Status          string       `json:"status"`
+	RunID           string       `json:"run_id,omitempty"` // see paisanos logs
+	StartedAt       time.Time    `json:"started_at"`
+	FinishedAt      time.Time    `json:"finished_at,omitzero"`
+	Machine         machineInfo  `json:"machine"`
+	Catalog         string       `json:"catalog"`
+	CatalogRevision string       `json:"catalog_revision,omitempty"` // commit or ETag of a remote catalog
+	Editor          string       `json:"editor"`
+	Profiles        []string     `json:"profiles,omitempty"`
+	Options         runOptions   `json:"options"`
+	Steps           []stepReport `json:"steps"`
+}
+
+// runOptions are the flags that shaped a run.
+type runOptions struct {
+	Jobs        int    `json:"jobs"`
+	KeepGoing   bool   `json:"keep_going"`
+	Resume      bool   `json:"resume"`
+	StepTimeout string `json:"step_timeout,omitempty"`
+}
+
+// machineInfo describes the machine a report comes from.
+type machineInfo struct {
+	Hostname  string `json:"hostname"`
+	User      string `json:"user"`
+	OS        string `json:"os"`
+	OSVersion string `json:"os_version,omitempty"`
+	Arch      string `json:"arch"`
+	CPUs      int    `json:"cpus"`
+}
+
+// stepReport is a step of a setupReport.
+type stepReport struct {
+	ID          string    `json:"id"`
+	Description string    `json:"description"`
+	Package     string    `json:"package,omitempty"`
+	Command     string    `json:"command,omitempty"`
+	Args        []string  `json:"args,omitempty"`
+	Action      string    `json:"action,omitempty"`
+	Env         []string  `json:"env,omitempty"`
+	DependsOn   []string  `json:"depends_on,omitempty"`
+	MaxAttempts int       `json:"max_attempts,omitempty"`
+	Timeout     string    `json:"timeout,omitempty"`
+	Privileged  bool      `json:"privileged,omitempty"`
+	Status      string    `json:"status"`
+	Version     string    `json:"version,omitempty"`            // installed version of the package
+	Constraint  string    `json:"version_constraint,omitempty"` // see catalog.Package.Version
+	Upgrade     bool      `json:"upgrade,omitempty"`            // upgrades an outdated package
+	Attempts    int       `json:"attempts,omitempty"`           // attempts actually run
+	StartedAt   time.Time `json:"started_at,omitzero"`
+	FinishedAt  time.Time `json:"finished_at,omitzero"`
+	Duration    float64   `json:"duration_seconds,omitempty"`
+	ExitCode    int       `json:"exit_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Caveats     string    `json:"caveats,omitempty"` // notes printed by Homebrew
+}
+
+// newSetupReport returns the report of plan p before it runs: the packages
+// already installed, the steps completed by a previous run and the pending
+// steps. ex describes the machine.
+func newSetupReport(ex executor.Executor, p plan, completed []step) *setupReport {
+	r := &setupReport{
+		Version:   Version,
+		Status:    reportPlanned,
+		StartedAt: time.Now(),
+		Machine:   currentMachine(ex),
+		Options: runOptions{
+			Jobs:        jobs,
+			KeepGoing:   keepGoing,
+			Resume:      resume,
+			StepTimeout: durationString(stepTimeout),
+		},
+		Steps: []stepReport{},
+	}
+	for _, pkg := range p.skipped {
+		r.Steps = append(r.Steps, stepReport{
+			ID:          packageStepID(pkg),
+			Description: installingDescription(pkg.Name),
+			Package:     pkg.Name,
+			Status:      reportStepPresent,
+		})
+	}
+	for _, v := range p.incompatible {
+		r.Steps = append(r.Steps, stepReport{
+			ID:          packageStepID(v.pkg),
+			Description: installingDescription(v.pkg.Name),
+			Package:     v.pkg.Name,
+			Status:      reportStepIncompatible,
+			Version:     v.installed,
+			Constraint:  v.pkg.Version,
+			Error:       v.String(),
+		})
+	}
+	for _, s := range completed {
+		sr := newStepReport(s)
+		sr.Status = reportStepResumed
+		r.Steps = append(r.Steps, sr)
+	}
+	for _, s := range p.steps {
+		r.Steps = append(r.Steps, newStepReport(s))
+	}
+	return r
+}
+
+func newStepReport(s step) stepReport {
+	return stepReport{
+		ID:          s.id,
+		Description: s.description,
+		Package:     s.pkg,
+		Constraint:  s.version,
+		Upgrade:     s.upgrade,
+		Command:     s.command,
+		Args:        s.args,
+		Action:      s.actionString(),
+		Env:         s.env,
+		DependsOn:   s.deps,
+		MaxAttempts: s.retry.attempts(),
+		Timeout:     durationString(s.timeout),
+		Privileged:  s.privileged,
+		Status:      reportStepPending,
+	}
+}
+
+// finish records the outcome of the steps run by m.
+func (r *setupReport) finish(m *setupModel) {
+	r.FinishedAt = time.Now()
+	switch {
+	case m.userAborted:
+		r.Status = reportAborted
+	case m.failed():
+		r.Status = reportFailed
+	default:
+		r.Status = reportSuccess
+	}
+	if m.log != nil {
+		r.RunID = m.log.ID
+	}
+	for i := range r.Steps {
+		sr := &r.Steps[i]
+		j, ok := m.index[sr.ID]
+		if !ok || sr.Status != reportStepPending {
+			continue
+		}
+		switch m.status[j] {
+		case statusDone:
+			sr.Status = reportStepDone
+		case statusFailed:
+			sr.Status = reportStepFailed
+		case statusWarned:
+			sr.Status = reportStepWarned
+		case statusSkipped:
+			sr.Status = reportStepSkipped
+		case statusCancelled:
+			sr.Status = reportStepCancelled
+		}
+		if m.attempt[j] == 0 {
+			continue
+		}
+		sr.Attempts = m.attempt[j]
+		sr.StartedAt = m.started[j]
+		sr.FinishedAt = m.ended[j]
+		sr.Duration = m.ended[j].Sub(m.started[j]).Seconds()
+		sr.ExitCode = m.exitCode[j]
+		sr.Caveats = m.caveats[j]
+		if m.errs[j] != nil {
+			sr.Error = m.errs[j].Error()
+		}
+	}
+}
+
+// addVersions records the installed version of the packages present on
+// the machine, as listed by inv.
+func (r *setupReport) addVersions(inv *probe.Inventory) {
+	for i := range r.Steps {
+		sr := &r.Steps[i]
+		if sr.Package == "" || (sr.Status != reportStepDone && sr.Status != reportStepPresent && sr.Status != reportStepResumed) {
+			continue
+		}
+		// brew list knows nothing of App Store apps, and drops taps.
+		var versions map[string][]string
+		switch kind, _, _ := strings.Cut(sr.ID, ":"); catalog.Kind(kind) {
+		case catalog.KindFormula:
+			versions = inv.Formulae
+		case catalog.KindCask:
+			versions = inv.Casks
+		}
+		sr.Version = strings.Join(versions[path.Base(sr.Package)], " ")
+	}
+}
+
+// writeReport writes r as indented JSON.
+func writeReport(w io.Writer, r *setupReport) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// currentMachine describes the machine paisanos runs on, asking ex for the
+// macOS version.
+func currentMachine(ex executor.Executor) machineInfo {
+	m := machineInfo{OS: runtime.GOOS, Arch: runtime.GOARCH, CPUs: runtime.NumCPU()}
+	m.Hostname, _ = os.Hostname()
+	if u, err := user.Current(); err == nil {
+		m.User = u.Username
+	}
+	if runtime.GOOS == "darwin" {
+		var out bytes.Buffer
+		cmd := executor.Command{Name: "sw_vers", Args: []string{"-productVersion"}}
+		if err := ex.Run(context.Background(), cmd, &out); err == nil {
+			m.OSVersion = strings.TrimSpace(out.String())
+		}
+	}
+	return m
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"regexp"
+	"slices"
+	"time"
+
+	"paisanos-cli/cmd/catalog"
+)
+
+// retryPolicy controls how a failed step is retried.
+type retryPolicy struct {
+	maxAttempts int              // total attempts, 1 disables retries
+	backoff     time.Duration    // delay before the second attempt, doubled after each one
+	maxBackoff  time.Duration    // upper bound for the delay, 0 means none
+	exitCodes   []int            // exit codes worth retrying
+	patterns    []*regexp.Regexp // output patterns worth retrying
+}
+
+// brewRetryPatterns match brew failures caused by a concurrent brew holding
+// a lock or by a flaky network, which usually succeed on a second try.
+var brewRetryPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`has already locked`),
+	regexp.MustCompile(`Another active Homebrew`),
+	regexp.MustCompile(`already running`),
+	regexp.MustCompile(`curl: \(\d+\)`),
+	regexp.MustCompile(`(?i)download failed`),
+	regexp.MustCompile(`(?i)connection (reset|refused|timed out)`),
+	regexp.MustCompile(`(?i)could not resolve host`),
+}
+
+// brewRetry is the default policy of brew steps.
+var brewRetry = retryPolicy{
+	maxAttempts: 3,
+	backoff:     2 * time.Second,
+	maxBackoff:  30 * time.Second,
+	patterns:    brewRetryPatterns,
+}
+
+// attempts returns the total number of attempts allowed, at least one.
+func (r retryPolicy) attempts() int {
+	return max(r.maxAttempts, 1)
+}
+
+// shouldRetry reports whether a step that failed on attempt with the given
+// exit code and output deserves another attempt. A policy without exit
+// codes nor patterns retries every failure.
+func (r retryPolicy) shouldRetry(attempt, exitCode int, output []byte) bool {
+	if attempt >= r.attempts() {
+		return false
+	}
+	if len(r.exitCodes) == 0 && len(r.patterns) == 0 {
+		return true
+	}
+	if slices.Contains(r.exitCodes, exitCode) {
+		return true
+	}
+	for _, p := range r.patterns {
+		if p.Match(output) {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns how long to wait before the attempt after the given one.
+func (r retryPolicy) delay(attempt int) time.Duration {
+	d := r.backoff << (attempt - 1)
+	if r.maxBackoff > 0 && (d > r.maxBackoff || d < r.backoff) {
+		d = r.maxBackoff
+	}
+	return d
+}
+
+// withOverrides applies the catalog retry settings of a package on top of
+// the policy. Exit codes and patterns are added to the existing ones.
+func (r retryPolicy) withOverrides(c *catalog.Retry) retryPolicy {
+	if c == nil {
+		return r
+	}
+	if c.Attempts > 0 {
+		r.maxAttempts = c.Attempts
+	}
+	if d, err := time.ParseDuration(c.Backoff); err == nil {
+		r.backoff = d
+	}
+	r.exitCodes = append(slices.Clone(r.exitCodes), c.ExitCodes...)
+	r.patterns = slices.Clone(r.patterns)
+	for _, p := range c.Patterns {
+		// Patterns are validated when the catalog is loaded.
+		r.patterns = append(r.patterns, regexp.MustCompile(p))
+	}
+	return r
+}
@@ -6,11 +6,27 @@ package cmd
 import (
 	"fmt"
 	"os"
+
+	"github.com/spf13/cobra"
 )
 
+// Version is the binary version, set at build time with
+// -ldflags "-X paisanos-cli/cmd.Version=v1.2.3".
+var Version = "dev"
+
+// RootCmd is the paisanos command. Without a subcommand it runs setup.
+var RootCmd = &cobra.Command{
+	Use:     "paisanos",
+	Short:   "Herramientas para el onboarding de paisanos",
+	Version: Version,
+	Run: func(cmd *cobra.Command, args []string) {
+		SetupCmd.Run(cmd, args)
+	},
+}
+
 // Execute runs the Cobra command.
 func Execute() {
-	if err := SetupCmd.Execute(); err != nil {
+	if err := RootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
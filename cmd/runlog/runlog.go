@@ -0,0 +1,247 @@
+// Package runlog writes a JSON-lines log for every setup run and reads the
+// logs of past runs back.
+package runlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"paisanos-cli/cmd/state"
+)
+
+// MaxOutput is how many trailing bytes of a step output are logged.
+const MaxOutput = 4096
+
+// idLayout is the time layout of run IDs, which are also the file names.
+const idLayout = "20060102-150405"
+
+// Entry types.
+const (
+	TypeRunStart = "run_start"
+	TypeStep     = "step"
+	TypeRunEnd   = "run_end"
+)
+
+// Step statuses.
+const (
+	StepDone         = "done"
+	StepFailed       = "failed"
+	StepCancelled    = "cancelled"
+	StepWarned       = "warned"       // failed, but the step only warns
+	StepRetrying     = "retrying"     // the attempt failed and the step is retried
+	StepPresent      = "present"      // already installed, not run
+	StepResumed      = "resumed"      // completed by a previous run, not run
+	StepIncompatible = "incompatible" // installed with a version outside its constraint, not run
+)
+
+// Run statuses written in the run_end entry.
+const (
+	RunSuccess = "success"
+	RunFailed  = "failed"
+	RunAborted = "aborted"
+)
+
+// Entry is a single line of a run log.
+type Entry struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+
+	// run_start
+	Version  string `json:"version,omitempty"`
+	Hostname string `json:"hostname,omitempty"`
+	OS       string `json:"os,omitempty"`
+
+	// step
+	StepID      string    `json:"step_id,omitempty"`
+	Description string    `json:"description,omitempty"`
+	Command     string    `json:"command,omitempty"`
+	Args        []string  `json:"args,omitempty"`
+	Action      string    `json:"action,omitempty"` // native action run instead of a command
+	Env         []string  `json:"env,omitempty"`
+	Attempt     int       `json:"attempt,omitempty"`
+	StartedAt   time.Time `json:"started_at,omitzero"`
+	FinishedAt  time.Time `json:"finished_at,omitzero"`
+	ExitCode    int       `json:"exit_code"`
+	Output      string    `json:"output,omitempty"`
+	Error       string    `json:"error,omitempty"`
+
+	// step and run_end
+	Status string `json:"status,omitempty"`
+}
+
+// Log is an open run log. It is safe for concurrent use.
+type Log struct {
+	ID string
+
+	mu   sync.Mutex
+	f    *os.File
+	enc  *json.Encoder
+	path string
+}
+
+// Dir returns the directory holding the run logs.
+func Dir() (string, error) {
+	dir, err := state.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "runs"), nil
+}
+
+// Create opens the log of a new run started at now.
+func Create(now time.Time) (*Log, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating log dir: %w", err)
+	}
+	// Runs started within the same second get a numeric suffix.
+	base := now.Format(idLayout)
+	for n := 1; ; n++ {
+		id := base
+		if n > 1 {
+			id = fmt.Sprintf("%s-%d", base, n)
+		}
+		path := filepath.Join(dir, id+".jsonl")
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("creating run log: %w", err)
+		}
+		return &Log{ID: id, f: f, enc: json.NewEncoder(f), path: path}, nil
+	}
+}
+
+// Path returns the location of the log file.
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Write appends e to the log, stamping its time if unset.
+func (l *Log) Write(e Entry) error {
+	if l == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.enc.Encode(e)
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+// Truncate keeps the last max bytes of output.
+func Truncate(output []byte, max int) string {
+	if len(output) <= max {
+		return string(output)
+	}
+	return "…" + string(output[len(output)-max:])
+}
+
+// Run summarizes a past run.
+type Run struct {
+	ID        string
+	StartedAt time.Time
+	Status    string // empty if the run never finished
+	Steps     int
+	Failed    int
+}
+
+// List returns the past runs, newest first.
+func List() ([]Run, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(files)
+	slices.Reverse(files)
+
+	runs := make([]Run, 0, len(files))
+	for _, f := range files {
+		id := strings.TrimSuffix(filepath.Base(f), ".jsonl")
+		entries, err := Read(id)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, summarize(id, entries))
+	}
+	return runs, nil
+}
+
+// Read returns the entries of the run with the given ID.
+func Read(id string) ([]Entry, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(dir, filepath.Base(id)+".jsonl"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("run %q not found", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s.jsonl:%d: %w", id, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+func summarize(id string, entries []Entry) Run {
+	r := Run{ID: id}
+	if t, err := time.ParseInLocation(idLayout, id[:min(len(id), len(idLayout))], time.Local); err == nil {
+		r.StartedAt = t
+	}
+	// The last entry of a step holds its final status.
+	final := make(map[string]string)
+	for _, e := range entries {
+		switch e.Type {
+		case TypeRunStart:
+			r.StartedAt = e.Time
+		case TypeStep:
+			final[e.StepID] = e.Status
+		case TypeRunEnd:
+			r.Status = e.Status
+		}
+	}
+	r.Steps = len(final)
+	for _, status := range final {
+		if status == StepFailed {
+			r.Failed++
+		}
+	}
+	return r
+}
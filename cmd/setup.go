@@ -1,17 +1,26 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"os/user"
+	"paisanos-cli/cmd/brewfile"
+	"paisanos-cli/cmd/catalog"
+	"paisanos-cli/cmd/executor"
+	"paisanos-cli/cmd/probe"
 	"paisanos-cli/cmd/program"
+	"paisanos-cli/cmd/state"
 	"paisanos-cli/cmd/ui/flag"
 	"paisanos-cli/cmd/ui/multiInput"
+	"paisanos-cli/cmd/ui/multiSelect"
 	"runtime"
+	"slices"
 	"strings"
+	"time"
 
-	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/spf13/cobra"
@@ -25,311 +34,467 @@ var (
 	installing   = lipgloss.NewStyle().Foreground(lipgloss.Color("44")).Render
 	installed    = lipgloss.NewStyle().Foreground(lipgloss.Color("29")).Render
 	skipped      = lipgloss.NewStyle().Foreground(lipgloss.Color("246")).Render
+	failed       = lipgloss.NewStyle().Foreground(lipgloss.Color("160")).Render
+	warning      = lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Render
 )
 
-// Lists for normal (formula) and cask installations.
-var normalInstallations = []string{
-	"fnm",
+// Flags of the setup command.
+var (
+	manifestPath string        // overrides the embedded package catalog when set
+	catalogURL   string        // remote catalog: an HTTPS URL or a git remote
+	dryRun       bool          // print the plan instead of executing it
+	planFormat   string        // output format of the dry-run plan
+	jobs         int           // maximum number of steps running at once
+	resume       bool          // skip the steps completed by a previous run
+	keepGoing    bool          // keep running the remaining steps after a failure
+	stepTimeout  time.Duration // default timeout of each step attempt
+	assumeYes    bool          // answer every question with its default
+	editorName   string        // editor to install, skipping the picker
+	profiles     []string      // catalog profiles whose packages are installed
+	noTUI        bool          // plain line-oriented output, no Bubble Tea programs
+	outputFormat string        // text, or json to print the results on stdout
+	reportPath   string        // Markdown or HTML report written at the end
+	brewfilePath string        // Brewfile whose entries are installed too
+)
+
+type Options struct {
+	Editor *multiInput.Selection
 }
 
-var caskInstallations = []string{
-	"figma",
-	"notion",
-	"slack",
-	"google-chrome",
+// signatureProblem explains why a remote catalog was refused.
+func signatureProblem(err *catalog.SignatureError) string {
+	switch {
+	case errors.Is(err, catalog.ErrNoPublicKey):
+		return "este binario no trae la clave pública del equipo (catalog.pub)"
+	case errors.Is(err, catalog.ErrMissingSignature):
+		return "no se encontró el archivo " + catalog.SignatureSuffix
+	case errors.Is(err, catalog.ErrMalformedSignature):
+		return "la firma está mal formada"
+	case errors.Is(err, catalog.ErrSignatureMismatch):
+		return "la firma no coincide con el contenido"
+	}
+	return err.Err.Error()
 }
 
-type Options struct {
-	Editor *multiInput.Selection
+// catalogOrigin describes the copy of a remote catalog that could not be
+// fetched.
+func catalogOrigin(cat *catalog.Catalog) string {
+	if cat.Source == catalog.DefaultSource {
+		return "embebida"
+	}
+	return "en caché"
 }
 
-type step struct {
-	description string   // A description of the step.
-	command     string   // The command to execute.
-	args        []string // Arguments for the command.
+// loadCatalog loads the catalog picked by --manifest or --catalog, the
+// embedded one by default, and exits when it cannot be used.
+func loadCatalog(out io.Writer) *catalog.Catalog {
+	if manifestPath != "" && catalogURL != "" {
+		fmt.Fprintln(out, "Usá --manifest o --catalog, no ambos.")
+		os.Exit(1)
+	}
+	var cat *catalog.Catalog
+	var err error
+	if catalogURL != "" {
+		cat, err = catalog.LoadRemote(context.Background(), executor.System{}, catalogURL)
+	} else {
+		cat, err = catalog.Load(manifestPath)
+	}
+	var sigErr *catalog.SignatureError
+	if errors.As(err, &sigErr) && errors.Is(err, catalog.ErrNoPublicKey) {
+		fmt.Fprintln(out, failed(fmt.Sprintf("✘  No se puede verificar el catálogo %s: %s.", sigErr.Source, signatureProblem(sigErr))))
+		fmt.Fprintln(out, helpStyle("Usá el catálogo embebido o --manifest hasta que se publique una versión con la clave."))
+		os.Exit(1)
+	}
+	if errors.As(err, &sigErr) {
+		fmt.Fprintln(out, failed(fmt.Sprintf("✘  El catálogo %s no tiene una firma válida: %s.", sigErr.Source, signatureProblem(sigErr))))
+		fmt.Fprintln(out, textStyle("Puede haber sido modificado por alguien ajeno al equipo, así que no se ejecuta ningún paso."))
+		fmt.Fprintln(out, helpStyle("Pedile a quien mantiene el catálogo que lo firme con `paisanos catalog sign`."))
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(out, "Error cargando el catálogo: %v\n", err)
+		os.Exit(1)
+	}
+	if cat.FetchErr != nil {
+		fmt.Fprintln(out, warning(fmt.Sprintf("No se pudo descargar el catálogo (%v).", cat.FetchErr)))
+		fmt.Fprintln(out, warning(fmt.Sprintf("Se usa la copia %s.", catalogOrigin(cat))))
+	} else if cat.Revision != "" {
+		fmt.Fprintln(out, helpStyle(fmt.Sprintf("Catálogo %s (%s)", cat.Source, cat.Revision)))
+	}
+	return cat
 }
 
 // installingDescription returns the installation description for a package.
 func installingDescription(pkg string) string {
-	return installing(fmt.Sprintf("Instalando %s...", pkg))
+	return fmt.Sprintf("Instalando %s...", pkg)
 }
 
 func alreadyInstalled(pkg string) string {
 	return skipped(fmt.Sprintf("■ %s ya se encuentra instalado.", pkg))
 }
 
-func successfullyInstalled(pkg string) string {
-	return installed(fmt.Sprintf("✔  %s instalado correctamente.", pkg))
+// alreadyCompleted is printed for steps skipped by --resume.
+func alreadyCompleted(desc string) string {
+	return skipped(fmt.Sprintf("■ %s (completado en una ejecución anterior)", desc))
 }
 
-// commandResultMsg is the message returned when a command completes.
-type commandResultMsg struct {
-	stepIndex int
-	err       error
+func successfullyInstalled(pkg string) string {
+	return installed(fmt.Sprintf("✔  %s instalado correctamente.", pkg))
 }
 
-// setupModel is the Bubble Tea model that runs our setup steps.
-type setupModel struct {
-	spinner     spinner.Model
-	steps       []step
-	currentStep int
-	done        bool
-	err         error
+func successfullyUpgraded(pkg string) string {
+	return installed(fmt.Sprintf("✔  %s actualizado correctamente.", pkg))
 }
 
-// Init starts the spinner and executes the first step.
-func (m *setupModel) Init() tea.Cmd {
-	if len(m.steps) == 0 {
-		m.done = true
-
-		return nil
-	}
-
-	if len(m.steps) > 0 {
-		return tea.Batch(m.spinner.Tick, runCommand(m.steps[m.currentStep], m.currentStep))
-	}
-	return m.spinner.Tick
-}
-
-// Update handles messages (spinner ticks and command results).
-func (m *setupModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	// If the setup is done, ignore further messages and quit.
-	if m.done {
-		return m, tea.Quit
-	}
-
-	var cmds []tea.Cmd
-	var cmd tea.Cmd
-
-	switch msg := msg.(type) {
-	case spinner.TickMsg:
-		m.spinner, cmd = m.spinner.Update(msg)
-		// Only schedule new ticks if not done.
-		cmds = append(cmds, cmd)
-
-	case commandResultMsg:
-		if msg.err != nil {
-			m.err = msg.err
-			return m, tea.Quit
-		}
-		// Print success message if appropriate.
-		prevStep := m.steps[m.currentStep]
-		if strings.HasPrefix(prevStep.description, "▶ Instalando ") &&
-			!strings.Contains(prevStep.description, "Homebrew") {
-			pkg := strings.TrimSuffix(strings.TrimPrefix(prevStep.description, "▶ Instalando "), "...")
-			fmt.Println(successfullyInstalled(pkg))
-		}
-		m.currentStep++
-		if m.currentStep < len(m.steps) {
-			cmds = append(cmds, runCommand(m.steps[m.currentStep], m.currentStep))
-		} else {
-			m.done = true
-			return m, tea.Quit
-		}
-	}
-
-	return m, tea.Batch(cmds...)
+// incompatibleVersion is printed for the installed packages whose version
+// does not meet their constraint and cannot be upgraded into it.
+func incompatibleVersion(v versionMismatch) string {
+	return warning(fmt.Sprintf("⚠  %s: versión incompatible, no se modifica.", v))
 }
 
-// View renders the current UI of the setup.
-func (m *setupModel) View() string {
-	if m.err != nil {
-		return fmt.Sprintf("\n%s\n", textStyle(fmt.Sprintf("Error: %v", m.err)))
-	}
-	if m.done {
-		return textStyle("\nTu setup se ha completado correctamente 🚀\n")
-	}
-	desc := m.steps[m.currentStep].description
-	return fmt.Sprintf("\n%s %s\n", m.spinner.View(), textStyle(desc))
+func failedStep(name string) string {
+	return failed(fmt.Sprintf("✘  %s falló.", name))
 }
 
-// runCommand returns a Tea command that executes a step.
-// For the Homebrew installation step it sets NONINTERACTIVE=1.
-func runCommand(s step, index int) tea.Cmd {
-	return func() tea.Msg {
-		cmd := exec.Command(s.command, s.args...)
-		if s.description == "Installing Homebrew..." {
-			cmd.Env = append(os.Environ(), "NONINTERACTIVE=1")
-		}
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			return commandResultMsg{
-				stepIndex: index,
-				err:       fmt.Errorf("%q failed: %v (%s)", s.description, err, output),
-			}
-		}
-		return commandResultMsg{stepIndex: index, err: nil}
-	}
+func warnedStep(name string) string {
+	return warning(fmt.Sprintf("⚠  %s falló, se continúa.", name))
 }
 
-// newSetupModel creates a new setup model with our steps and a single spinner.
-func newSetupModel(steps []step) *setupModel {
-	sp := spinner.New()
-	sp.Style = spinnerStyle
-	sp.Spinner = spinner.Line
-	return &setupModel{
-		spinner:     sp,
-		steps:       steps,
-		currentStep: 0,
-		done:        false,
-	}
+func cancelledStep(name string) string {
+	return skipped(fmt.Sprintf("■ %s cancelado.", name))
 }
 
 type listOptions struct {
 	options []string
 }
 
-// fileExists returns true if the given filename exists.
-func fileExists(filename string) bool {
-	_, err := os.Stat(filename)
-	return err == nil
-}
-
 // SetupCmd is a Cobra command that sets up your macOS environment.
 var SetupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Configura tu entorno de macOS",
 	Run: func(cmd *cobra.Command, args []string) {
-		// Ensure this command runs only on macOS.
-		if runtime.GOOS != "darwin" {
-			fmt.Println("Este comando solo funciona en macOS.")
+		// Prompts and progress go to stderr when stdout carries the plan
+		// or the JSON results.
+		out := humanOutput()
+
+		// Ensure this command runs only on macOS. A dry-run only prints
+		// the plan, so it is allowed everywhere.
+		if runtime.GOOS != "darwin" && !dryRun {
+			fmt.Fprintln(out, "Este comando solo funciona en macOS.")
 			return
 		}
 
-		program := program.Project{}
-
-		tprogram := tea.NewProgram(flag.InitialModelFlag(&program))
-		if _, err := tprogram.Run(); err != nil {
-			fmt.Printf("Error during setup: %v\n", err)
+		if dryRun && !slices.Contains(planFormats, planFormat) {
+			fmt.Fprintf(out, "Formato de plan desconocido: %q (table, json o script)\n", planFormat)
+			os.Exit(1)
+		}
+		if !slices.Contains(outputFormats, outputFormat) {
+			fmt.Fprintf(out, "Formato de salida desconocido: %q (text o json)\n", outputFormat)
 			os.Exit(1)
 		}
 
-		listOfEditors := listOptions{
-			options: []string{"neovim", "cursor", "visual-studio-code"},
+		if reportPath != "" {
+			if _, err := reportFileFormat(reportPath); err != nil {
+				fmt.Fprintf(out, "Error: %v\n", err)
+				os.Exit(1)
+			}
 		}
 
-		options := Options{
-			Editor: &multiInput.Selection{},
+		cat := loadCatalog(out)
+
+		var bf *brewfile.File
+		var err error
+		if brewfilePath != "" {
+			if bf, err = brewfile.Load(brewfilePath); err != nil {
+				fmt.Fprintf(out, "Error leyendo el Brewfile: %v\n", err)
+				os.Exit(1)
+			}
+			for _, l := range bf.Skipped {
+				reason := "paisanos solo instala entradas tap, brew, cask y mas."
+				if l.Conditional {
+					reason = "paisanos no evalúa condiciones ni bloques de Ruby."
+				}
+				fmt.Fprintln(out, warning(fmt.Sprintf("%s:%d: se ignora `%s`: %s", bf.Source, l.Number, l.Text, reason)))
+			}
+		}
+
+		program := program.Project{}
+		tui := interactive()
+
+		teaOpts := []tea.ProgramOption{tea.WithOutput(out)}
+		if tui && !dryRun {
+			tprogram := tea.NewProgram(flag.InitialModelFlag(&program), teaOpts...)
+			if _, err := tprogram.Run(); err != nil {
+				fmt.Fprintf(out, "Error during setup: %v\n", err)
+				os.Exit(1)
+			}
+			program.ExitCLI(tprogram)
+		}
+
+		// Without a terminal every answer comes from the flags, or from the
+		// defaults with --yes; a missing one fails right away.
+		if editorName == "" {
+			switch {
+			case tui:
+				listOfEditors := listOptions{
+					options: cat.EditorNames(),
+				}
+
+				options := Options{
+					Editor: &multiInput.Selection{},
+				}
+
+				tprogram := tea.NewProgram(multiInput.InitialModelMulti(listOfEditors.options, options.Editor, "Selecciona tu editor de confianza", &program), teaOpts...)
+				if _, err := tprogram.Run(); err != nil {
+					fmt.Fprintf(out, "Error during setup: %v\n", err)
+					os.Exit(1)
+				}
+				program.ExitCLI(tprogram)
+				editorName = options.Editor.Choice
+			case assumeYes && len(cat.Editors) > 0:
+				editorName = cat.Editors[0].Name
+			default:
+				fmt.Fprintf(out, "Falta elegir un editor: usá --editor (%s) o --yes.\n", strings.Join(cat.EditorNames(), ", "))
+				os.Exit(1)
+			}
 		}
 
-		tprogram = tea.NewProgram(multiInput.InitialModelMulti(listOfEditors.options, options.Editor, "Selecciona tu editor de confianza", &program))
-		if _, err := tprogram.Run(); err != nil {
-			fmt.Printf("Error during setup: %v\n", err)
+		editor, ok := cat.Find(editorName)
+		if !ok || !slices.Contains(cat.EditorNames(), editorName) {
+			fmt.Fprintf(out, "Editor desconocido: %q (%s)\n", editorName, strings.Join(cat.EditorNames(), ", "))
 			os.Exit(1)
 		}
+		// Profiles combine, so the picker allows several; picking none
+		// installs the default packages, as without profiles.
+		if len(profiles) == 0 && tui && len(cat.Profiles) > 0 {
+			items := make([]multiSelect.Item, 0, len(cat.Profiles))
+			for _, p := range cat.Profiles {
+				items = append(items, multiSelect.Item{
+					Title: p.Name,
+					Desc:  fmt.Sprintf("%s: %s", p.Description, strings.Join(p.Packages, ", ")),
+					Flag:  p.Name,
+				})
+			}
+			selection := &multiSelect.Selection{Choices: make(map[string]bool)}
+			header := "Elegí tus perfiles (espacio para marcar, ninguno instala los paquetes base)"
+			tprogram := tea.NewProgram(multiSelect.InitialModelMultiSelect(items, selection, header, &program), teaOpts...)
+			if _, err := tprogram.Run(); err != nil {
+				fmt.Fprintf(out, "Error during setup: %v\n", err)
+				os.Exit(1)
+			}
+			program.ExitCLI(tprogram)
+			for _, name := range cat.ProfileNames() {
+				if selection.Choices[name] {
+					profiles = append(profiles, name)
+				}
+			}
+		}
 
-		if options.Editor.Choice == "neovim" {
-			fmt.Println("Ninja neovim detectado 🥷")
-			normalInstallations = append(normalInstallations, "neovim")
-		} else {
-			caskInstallations = append(caskInstallations, options.Editor.Choice)
+		packages := cat.DefaultPackages()
+		if len(profiles) > 0 {
+			packages, err = cat.ProfilePackages(profiles)
+			if err != nil {
+				fmt.Fprintf(out, "Error: %v\n", err)
+				os.Exit(1)
+			}
 		}
+		packages = append(packages, editor)
+		var taps []string
+		if bf != nil {
+			packages = mergePackages(packages, bf.Packages)
+			taps = bf.Taps
+		}
+		taps = packageTaps(taps, packages)
 
 		// Retrieve current user's home directory.
 		usr, err := user.Current()
 		if err != nil {
-			fmt.Printf("Error retrieving current user: %v\n", err)
+			fmt.Fprintf(out, "Error retrieving current user: %v\n", err)
 			return
 		}
 		profilePath := usr.HomeDir + "/.zprofile"
 
-		var steps []step
-		brewInstalled := false
-
-		// Check if Homebrew is installed.
-		if _, err := exec.LookPath("brew"); err != nil {
-			// Homebrew is not installed; add installation steps.
-			steps = append(steps, step{
-				description: "Instalando Homebrew...",
-				command:     "/bin/bash",
-				args: []string{
-					"-c",
-					"$(curl -fsSL https://raw.githubusercontent.com/Homebrew/install/HEAD/install.sh)",
-				},
-			})
-			steps = append(steps, step{
-				description: "Configurando Homebrew...",
-				command:     "/bin/bash",
-				args: []string{
-					"-c",
-					fmt.Sprintf(`(echo; echo 'eval "$(/opt/homebrew/bin/brew shellenv)"') >> %s`, profilePath),
-				},
-			})
-			steps = append(steps, step{
-				description: "Evaluando entorno de Homebrew...",
-				command:     "/bin/bash",
-				args:        []string{"-c", `eval "$(/opt/homebrew/bin/brew shellenv)"`},
-			})
+		// The state file is only touched by real runs, or read to resume.
+		var st *state.State
+		if resume || !dryRun {
+			st, err = state.Load(Version)
+			if err != nil {
+				fmt.Fprintf(out, "Error leyendo el estado: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		var ex executor.Executor = executor.System{}
+
+		var found detection
+		if tui {
+			found, err = probeWithSpinner(ex, packages, out)
 		} else {
-			brewInstalled = true
-			fmt.Println("Homebrew ya se encuentra instalada, saltando instalación.")
-		}
-
-		// Append normal (formula) installation steps.
-		for _, pkg := range normalInstallations {
-			if brewInstalled {
-				// Check if the package is already installed.
-				if err := exec.Command("brew", "list", pkg).Run(); err != nil {
-					steps = append(steps, step{
-						description: installingDescription(pkg),
-						command:     "brew",
-						args:        []string{"install", pkg},
-					})
-				} else {
-					fmt.Println(alreadyInstalled(pkg))
-				}
-			} else {
-				steps = append(steps, step{
-					description: installingDescription(pkg),
-					command:     "brew",
-					args:        []string{"install", pkg},
-				})
+			fmt.Fprintln(out, "Buscando paquetes instalados...")
+			found = detectInstalled(context.Background(), ex, packages)
+		}
+		if errors.Is(err, errProbingCancelled) {
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "Error buscando paquetes instalados: %v\n", err)
+			os.Exit(1)
+		}
+
+		p := buildPlan(ex, packages, taps, found, profilePath).withHooks(cat.Before, cat.After)
+		p.setDefaultTimeout(stepTimeout)
+		var completed []step
+		if resume && st != nil {
+			p, completed = p.withoutCompleted(st)
+		}
+
+		report := newSetupReport(ex, p, completed)
+		report.Catalog = cat.Source
+		report.CatalogRevision = cat.Revision
+		report.Editor = editor.Name
+		report.Profiles = profiles
+
+		if dryRun {
+			format := planFormat
+			if outputFormat == outputJSON {
+				format = formatJSON
+			}
+			if err := printPlan(os.Stdout, p, format, report); err != nil {
+				fmt.Fprintf(out, "Error imprimiendo el plan: %v\n", err)
+				os.Exit(1)
 			}
+			saveReport(out, report)
+			return
 		}
 
-		// Append cask installation steps.
-		for _, pkg := range caskInstallations {
-			if brewInstalled {
-				// Special check for Google Chrome.
-				if pkg == "google-chrome" {
-					if fileExists("/Applications/Google Chrome.app") {
-						fmt.Println(alreadyInstalled(pkg))
-						continue
-					}
-					if err := exec.Command("brew", "list", "--cask", pkg).Run(); err != nil {
-						steps = append(steps, step{
-							description: installingDescription(pkg),
-							command:     "brew",
-							args:        []string{"install", "--cask", pkg},
-						})
-					} else {
-						fmt.Println(alreadyInstalled(pkg))
-					}
-				} else {
-					if err := exec.Command("brew", "list", "--cask", pkg).Run(); err != nil {
-						steps = append(steps, step{
-							description: installingDescription(pkg),
-							command:     "brew",
-							args:        []string{"install", "--cask", pkg},
-						})
-					} else {
-						fmt.Println(alreadyInstalled(pkg))
-					}
-				}
-			} else {
-				steps = append(steps, step{
-					description: installingDescription(pkg),
-					command:     "brew",
-					args:        []string{"install", "--cask", pkg},
-				})
+		if editor.Message != "" {
+			fmt.Fprintln(out, editor.Message)
+		}
+		if p.brewInstalled {
+			fmt.Fprintln(out, "Homebrew ya se encuentra instalada, saltando instalación.")
+		}
+		for _, pkg := range p.skipped {
+			fmt.Fprintln(out, alreadyInstalled(pkg.Name))
+		}
+		for _, v := range p.incompatible {
+			fmt.Fprintln(out, incompatibleVersion(v))
+		}
+		if len(p.incompatible) > 0 {
+			fmt.Fprintln(out, helpStyle("Desinstalalas con `brew uninstall` o usá una fórmula versionada (ej. node@20) y volvé a ejecutar el setup."))
+		}
+		for _, s := range completed {
+			fmt.Fprintln(out, alreadyCompleted(s.description))
+		}
+
+		if !resume && st != nil {
+			if err := st.Reset(); err != nil {
+				fmt.Fprintf(out, "Error guardando el estado: %v\n", err)
+				os.Exit(1)
 			}
 		}
 
-		// Create and start the Bubble Tea program with our steps.
-		m := newSetupModel(steps)
+		// Privileged steps cannot prompt for a password, so ask for it once
+		// up front and keep the credential alive while the steps run.
+		sudoCtx, stopSudo := context.WithCancel(context.Background())
+		if p.privileged() {
+			if err := acquireSudo(ex, &program, tui); err != nil {
+				fmt.Fprintln(out, failed(fmt.Sprintf("Error: %v", err)))
+				os.Exit(1)
+			}
+			keepSudoAlive(sudoCtx, ex)
+		}
 
-		tprogram = tea.NewProgram(m)
-		if _, err := tprogram.Run(); err != nil {
-			fmt.Printf("Error during setup: %v\n", err)
+		log := startRunLog(p, completed)
+
+		// Past durations estimate the time left.
+		history, err := state.LoadHistory()
+		if err != nil {
+			fmt.Fprintln(out, skipped(fmt.Sprintf("No se pudo leer el historial de duraciones: %v", err)))
+		}
+
+		// Create and start the Bubble Tea program with our steps.
+		m := newSetupModel(p.steps, engineOptions{
+			jobs:      jobs,
+			state:     st,
+			keepGoing: keepGoing,
+			exec:      ex,
+			log:       log,
+			history:   history,
+			plain:     plainOutput(tui),
+		})
+
+		if err := runModel(m); err != nil {
+			fmt.Fprintf(out, "Error during setup: %v\n", err)
+			os.Exit(1)
+		}
+		if !tui {
+			if m.err != nil {
+				fmt.Fprintln(out, failed(fmt.Sprintf("Error: %v", m.err)))
+			}
+			// An abort is reported by the resume hint below.
+			if !m.userAborted {
+				fmt.Fprintln(out, textStyle(m.outcome()))
+			}
+		}
+		stopSudo()
+		endRunLog(log, m)
+		if history != nil {
+			if err := history.Save(); err != nil {
+				fmt.Fprintln(out, skipped(fmt.Sprintf("No se pudo guardar el historial de duraciones: %v", err)))
+			}
+		}
+		if outputFormat == outputJSON || reportPath != "" {
+			report.finish(m)
+			// Versions are a nicety; without brew the report just omits them.
+			if inv, err := probe.LoadInventory(context.Background(), ex); err == nil {
+				report.addVersions(inv)
+			}
+		}
+		if outputFormat == outputJSON {
+			if err := writeReport(os.Stdout, report); err != nil {
+				fmt.Fprintf(out, "Error imprimiendo los resultados: %v\n", err)
+			}
+		}
+		saveReport(out, report)
+		results := m.results(p)
+		if keepGoing {
+			if err := printSummary(out, results); err != nil {
+				fmt.Fprintf(out, "Error imprimiendo el resumen: %v\n", err)
+			}
+		}
+		if m.userAborted {
+			fmt.Fprintln(out, helpStyle("\nSetup interrumpido. Ejecutá `paisanos setup --resume` para continuar."))
+			os.Exit(1)
+		}
+		if m.failed() {
+			printFailures(out, results)
+			fmt.Fprintln(out, helpStyle("\nEjecutá `paisanos setup --resume` para retomar desde el paso que falló."))
+			if log != nil {
+				fmt.Fprintln(out, helpStyle(fmt.Sprintf("El detalle de la ejecución quedó en `paisanos logs %s`.", log.ID)))
+			}
 			os.Exit(1)
 		}
 	},
 }
+
+func init() {
+	SetupCmd.Flags().StringVar(&manifestPath, "manifest", "", "ruta a un manifiesto YAML que reemplaza al catálogo embebido")
+	SetupCmd.Flags().StringVar(&catalogURL, "catalog", os.Getenv("PAISANOS_CATALOG"), "catálogo remoto del equipo: una URL https o un remoto de git (ej. git@github.com:equipo/catalogo.git#catalog.yaml); por defecto $PAISANOS_CATALOG")
+	SetupCmd.Flags().BoolVar(&dryRun, "dry-run", false, "muestra el plan de instalación sin ejecutar nada")
+	SetupCmd.Flags().StringVar(&planFormat, "format", formatTable, "formato del plan en --dry-run: table, json o script")
+	SetupCmd.Flags().BoolVar(&resume, "resume", false, "retoma la última ejecución salteando los pasos ya completados")
+	SetupCmd.Flags().BoolVarP(&keepGoing, "keep-going", "k", false, "continúa con los demás pasos si alguno falla y muestra un resumen al final")
+	SetupCmd.Flags().DurationVar(&stepTimeout, "step-timeout", 0, "tiempo máximo de cada paso (ej. 30m); 0 desactiva el límite")
+	SetupCmd.Flags().IntVarP(&jobs, "jobs", "j", defaultJobs, "cantidad máxima de pasos ejecutándose en paralelo")
+	SetupCmd.Flags().BoolVarP(&assumeYes, "yes", "y", false, "responde cada pregunta con su valor por defecto")
+	SetupCmd.Flags().StringVar(&editorName, "editor", "", "editor a instalar, sin mostrar el selector")
+	SetupCmd.Flags().StringSliceVar(&profiles, "profile", nil, "perfiles del catálogo a instalar, separados por coma (ej. frontend,design)")
+	SetupCmd.Flags().BoolVar(&noTUI, "no-tui", false, "muestra el progreso línea por línea, sin interfaz interactiva; se activa solo si no hay una terminal")
+	SetupCmd.Flags().StringVarP(&outputFormat, "output", "o", outputText, "formato de los resultados: text, o json para imprimirlos en stdout al terminar")
+	SetupCmd.Flags().StringVar(&brewfilePath, "brewfile", "", "instala también las entradas tap, brew, cask y mas de un Brewfile existente")
+	SetupCmd.Flags().StringVar(&reportPath, "report", "", "guarda un reporte del setup en Markdown o HTML según la extensión (ej. reporte.md, reporte.html)")
+
+	// Share the setup flags so `paisanos --dry-run` keeps working.
+	RootCmd.Flags().AddFlagSet(SetupCmd.Flags())
+	RootCmd.AddCommand(SetupCmd)
+}
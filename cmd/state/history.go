@@ -0,0 +1,95 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// historyFileName is the name of the duration history inside Dir.
+const historyFileName = "durations.json"
+
+// historyRuns bounds how many runs weigh in the average, so it follows the
+// machine (a faster network, a warm Homebrew cache) instead of settling.
+const historyRuns = 5
+
+// Duration is how long a step took in the previous runs on this machine.
+type Duration struct {
+	Seconds float64 `json:"seconds"` // average duration of a successful attempt
+	Runs    int     `json:"runs"`    // runs averaged, at most historyRuns
+}
+
+// History persists the step durations of past runs, used to estimate how
+// long the next run takes. Unlike the state file it is never reset.
+type History struct {
+	Steps map[string]Duration `json:"steps"`
+
+	path string
+}
+
+// LoadHistory reads the duration history. A missing file yields an empty
+// history.
+func LoadHistory() (*History, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	h := &History{
+		Steps: make(map[string]Duration),
+		path:  filepath.Join(dir, historyFileName),
+	}
+	data, err := os.ReadFile(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading duration history: %w", err)
+	}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, fmt.Errorf("parsing duration history %s: %w", h.path, err)
+	}
+	if h.Steps == nil {
+		h.Steps = make(map[string]Duration)
+	}
+	return h, nil
+}
+
+// Estimate returns the average duration of the step with the given ID, and
+// whether it ran before.
+func (h *History) Estimate(id string) (time.Duration, bool) {
+	d, ok := h.Steps[id]
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(d.Seconds * float64(time.Second)), true
+}
+
+// Observe adds a successful attempt of the step with the given ID to its
+// average. Call Save to persist it.
+func (h *History) Observe(id string, d time.Duration) {
+	prev := h.Steps[id]
+	runs := min(prev.Runs, historyRuns-1)
+	h.Steps[id] = Duration{
+		Seconds: (prev.Seconds*float64(runs) + d.Seconds()) / float64(runs+1),
+		Runs:    runs + 1,
+	}
+}
+
+// Save writes the history file atomically.
+func (h *History) Save() error {
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0o755); err != nil {
+		return fmt.Errorf("creating state dir: %w", err)
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("writing duration history: %w", err)
+	}
+	return os.Rename(tmp, h.path)
+}
@@ -0,0 +1,124 @@
+// Package state persists the progress of setup runs so an interrupted run
+// can be resumed.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// fileName is the name of the state file inside Dir.
+const fileName = "setup.json"
+
+// Step statuses stored in the state file.
+const (
+	StatusDone      = "done"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// StepRecord is the outcome of a single step.
+type StepRecord struct {
+	ID          string    `json:"id"`
+	Description string    `json:"description"`
+	Status      string    `json:"status"`
+	ExitCode    int       `json:"exit_code"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	Version     string    `json:"version"` // binary version that ran the step
+}
+
+// State is the persisted progress of the last setup run.
+type State struct {
+	Version   string                `json:"version"` // binary version that last wrote the file
+	StartedAt time.Time             `json:"started_at"`
+	UpdatedAt time.Time             `json:"updated_at"`
+	Steps     map[string]StepRecord `json:"steps"`
+
+	path string
+}
+
+// Dir returns the paisanos state directory, honoring XDG_STATE_HOME.
+func Dir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "paisanos"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolving home directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "paisanos"), nil
+}
+
+// Load reads the state file. A missing file yields an empty state.
+func Load(version string) (*State, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	s := &State{
+		Version: version,
+		Steps:   make(map[string]StepRecord),
+		path:    filepath.Join(dir, fileName),
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading state: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("parsing state %s: %w", s.path, err)
+	}
+	if s.Steps == nil {
+		s.Steps = make(map[string]StepRecord)
+	}
+	s.Version = version
+	return s, nil
+}
+
+// Path returns the location of the state file.
+func (s *State) Path() string {
+	return s.path
+}
+
+// Done reports whether the step with the given ID completed successfully.
+func (s *State) Done(id string) bool {
+	return s.Steps[id].Status == StatusDone
+}
+
+// Reset forgets every recorded step and starts a new run.
+func (s *State) Reset() error {
+	s.Steps = make(map[string]StepRecord)
+	s.StartedAt = time.Now()
+	return s.Save()
+}
+
+// Record stores the outcome of a step and saves the file.
+func (s *State) Record(rec StepRecord) error {
+	rec.Version = s.Version
+	s.Steps[rec.ID] = rec
+	return s.Save()
+}
+
+// Save writes the state file atomically.
+func (s *State) Save() error {
+	s.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("creating state dir: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("writing state: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"paisanos-cli/cmd/executor"
+	"paisanos-cli/cmd/program"
+	"paisanos-cli/cmd/ui/password"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// sudoKeepAlive is how often the sudo credential is refreshed while the
+	// steps run. sudo forgets it after 5 minutes by default.
+	sudoKeepAlive = time.Minute
+	// sudoAttempts is how many passwords the user may try.
+	sudoAttempts = 3
+)
+
+var (
+	// errSudoDenied is returned when no password was accepted.
+	errSudoDenied = errors.New("no se pudo validar la contraseña de sudo")
+	// errSudoNeeded is returned when sudo has no credential and there is
+	// no terminal to ask for the password.
+	errSudoNeeded = errors.New("algunos pasos necesitan sudo: ejecutá `sudo -v` antes o configurá sudo sin contraseña")
+)
+
+// privileged reports whether any step of the plan needs sudo.
+func (p plan) privileged() bool {
+	for _, s := range p.steps {
+		if s.privileged {
+			return true
+		}
+	}
+	return false
+}
+
+// acquireSudo makes sure sudo holds a cached credential, asking for the
+// password once in a masked prompt when it does not. Privileged steps run
+// without a terminal to prompt on, so they rely on that credential.
+// Without the TUI nothing can be asked, so a missing credential fails.
+func acquireSudo(ex executor.Executor, project *program.Project, tui bool) error {
+	ctx := context.Background()
+	if ex.Probe(ctx, executor.Command{Name: "sudo", Args: []string{"-n", "-v"}}) {
+		return nil
+	}
+	if !tui {
+		return errSudoNeeded
+	}
+	validate := func(pw string) error {
+		cmd := executor.Command{Name: "sudo", Args: []string{"-S", "-p", "", "-v"}, Stdin: pw + "\n"}
+		if err := ex.Run(ctx, cmd, io.Discard); err != nil {
+			return errors.New("contraseña incorrecta, intentá de nuevo")
+		}
+		return nil
+	}
+	var result password.Result
+	header := "Algunos pasos necesitan permisos de administrador.\nIngresá tu contraseña de macOS:"
+	tprogram := tea.NewProgram(password.InitialModelPassword(header, validate, sudoAttempts, &result, project), tea.WithOutput(humanOutput()))
+	if _, err := tprogram.Run(); err != nil {
+		return err
+	}
+	project.ExitCLI(tprogram)
+	if !result.Valid {
+		return errSudoDenied
+	}
+	return nil
+}
+
+// keepSudoAlive refreshes the sudo credential in the background until ctx
+// is cancelled.
+func keepSudoAlive(ctx context.Context, ex executor.Executor) {
+	go func() {
+		ticker := time.NewTicker(sudoKeepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ex.Probe(ctx, executor.Command{Name: "sudo", Args: []string{"-n", "-v"}})
+			}
+		}
+	}()
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Result labels shown in the summary table.
+const (
+	resultInstalled    = "instalado"
+	resultUpgraded     = "actualizado"
+	resultCompleted    = "completado"
+	resultWarned       = "advertencia"
+	resultPresent      = "ya instalado"
+	resultFailed       = "falló"
+	resultSkipped      = "omitido"
+	resultCancelled    = "cancelado"
+	resultIncompatible = "versión incompatible"
+)
+
+// stepResult is the outcome of a planned package or step.
+type stepResult struct {
+	name   string
+	status string
+	err    error
+	output []byte // full output when the step failed
+}
+
+// results returns the outcome of every step of p that reached a final
+// status, preceded by the packages that were already installed and the
+// ones whose installed version is incompatible.
+func (m *setupModel) results(p plan) []stepResult {
+	var out []stepResult
+	for _, pkg := range p.skipped {
+		out = append(out, stepResult{name: pkg.Name, status: resultPresent})
+	}
+	for _, v := range p.incompatible {
+		out = append(out, stepResult{name: v.pkg.Name, status: resultIncompatible})
+	}
+	for i, s := range m.steps {
+		r := stepResult{name: s.name(), err: m.errs[i], output: m.outputs[i]}
+		switch m.status[i] {
+		case statusDone:
+			r.status = resultCompleted
+			if s.upgrade {
+				r.status = resultUpgraded
+			} else if s.pkg != "" {
+				r.status = resultInstalled
+			}
+		case statusWarned:
+			r.status = resultWarned
+		case statusFailed:
+			r.status = resultFailed
+		case statusSkipped:
+			r.status = resultSkipped
+		case statusCancelled:
+			r.status = resultCancelled
+		default:
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// printSummary writes the results as a table.
+func printSummary(w io.Writer, results []stepResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nPAQUETE\tESTADO")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\n", r.name, r.status)
+	}
+	return tw.Flush()
+}
+
+// printFailures writes the error and the full output of every failed step,
+// and of every step that failed with a warning.
+func printFailures(w io.Writer, results []stepResult) {
+	for _, r := range results {
+		switch r.status {
+		case resultFailed:
+			fmt.Fprintf(w, "\n%s\n%v\n", failed("✘ "+r.name), r.err)
+		case resultWarned:
+			fmt.Fprintf(w, "\n%s\n%v\n", warning("⚠ "+r.name), r.err)
+		default:
+			continue
+		}
+		if len(r.output) > 0 {
+			fmt.Fprintf(w, "%s\n%s", helpStyle("Salida completa:"), r.output)
+		}
+	}
+}
@@ -31,6 +31,7 @@ func (s *Selection) Update(optionName string, value bool) {
 
 type Item struct {
 	Title string
+	Desc  string
 	Flag  string
 	Value string
 }
@@ -116,8 +117,9 @@ func (m model) View() string {
 		}
 
 		title := focusedStyle.Render(option.Title)
+		description := descriptionStyle.Render(option.Desc)
 
-		s += fmt.Sprintf("%s [%s] %s\n%s\n\n", cursor, checked, title)
+		s += fmt.Sprintf("%s [%s] %s\n%s\n\n", cursor, checked, title, description)
 	}
 
 	s += fmt.Sprintf("Press %s to confirm choice.\n", focusedStyle.Render("y"))
@@ -0,0 +1,113 @@
+package password
+
+import (
+	"paisanos-cli/cmd/program"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	titleStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("252")).Render
+	helpStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("241")).Render
+	errorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("160")).Render
+)
+
+// Result tells whether a password was accepted.
+type Result struct {
+	Valid bool
+}
+
+// validatedMsg carries the outcome of validating a password.
+type validatedMsg struct {
+	err error
+}
+
+type model struct {
+	input       textinput.Model
+	header      string
+	validate    func(password string) error
+	result      *Result
+	attempts    int
+	maxAttempts int
+	checking    bool
+	err         error
+	exit        *bool
+}
+
+func (m model) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+// InitialModelPassword asks for a masked password and checks it with
+// validate, allowing up to maxAttempts tries.
+func InitialModelPassword(header string, validate func(string) error, maxAttempts int, result *Result, program *program.Project) model {
+	input := textinput.New()
+	input.EchoMode = textinput.EchoPassword
+	input.EchoCharacter = '•'
+	input.Prompt = "> "
+	input.Focus()
+	return model{
+		input:       input,
+		header:      titleStyle(header),
+		validate:    validate,
+		result:      result,
+		maxAttempts: maxAttempts,
+		exit:        &program.Exit,
+	}
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case validatedMsg:
+		m.checking = false
+		if msg.err == nil {
+			m.result.Valid = true
+			return m, tea.Quit
+		}
+		m.err = msg.err
+		m.attempts++
+		m.input.Reset()
+		if m.attempts >= m.maxAttempts {
+			return m, tea.Quit
+		}
+		return m, nil
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c", "esc":
+			*m.exit = true
+			return m, tea.Quit
+		case "enter":
+			if m.checking || m.input.Value() == "" {
+				return m, nil
+			}
+			m.checking = true
+			password := m.input.Value()
+			validate := m.validate
+			return m, func() tea.Msg {
+				return validatedMsg{err: validate(password)}
+			}
+		}
+	}
+	if m.checking {
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+func (m model) View() string {
+	s := m.header + "\n\n" + m.input.View() + "\n"
+	switch {
+	case m.checking:
+		s += helpStyle("\n Verificando...")
+	case m.err != nil:
+		s += errorStyle("\n "+m.err.Error()) + "\n"
+		fallthrough
+	default:
+		s += helpStyle("\n enter: confirmar • esc: cancelar")
+	}
+	return s + "\n"
+}
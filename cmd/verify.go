@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"paisanos-cli/cmd/catalog"
+	"paisanos-cli/cmd/executor"
+	"paisanos-cli/cmd/probe"
+)
+
+// brewBinDirs are searched when a binary is not on PATH, e.g. right after
+// Homebrew itself was installed by this run and its shellenv is not loaded.
+var brewBinDirs = []string{"/opt/homebrew/bin", "/usr/local/bin"}
+
+// brewPathEnv returns the PATH of the steps that run after this run
+// installed Homebrew: brewBinDirs followed by our own PATH.
+func brewPathEnv() string {
+	dirs := append(slices.Clone(brewBinDirs), os.Getenv("PATH"))
+	return "PATH=" + strings.Join(dirs, string(os.PathListSeparator))
+}
+
+// brewPathExecutor runs every command with brewPathEnv, e.g. the brew list
+// that verifies the version a step installed.
+type brewPathExecutor struct {
+	executor.Executor
+}
+
+func (e brewPathExecutor) Run(ctx context.Context, c executor.Command, out io.Writer) error {
+	c.Env = append(slices.Clone(c.Env), brewPathEnv())
+	return e.Executor.Run(ctx, c, out)
+}
+
+func (e brewPathExecutor) Probe(ctx context.Context, c executor.Command) bool {
+	c.Env = append(slices.Clone(c.Env), brewPathEnv())
+	return e.Executor.Probe(ctx, c)
+}
+
+// defaultVersionArgs are the arguments of version checks without args.
+var defaultVersionArgs = []string{"--version"}
+
+// verifyPackage runs the checks of pkg in order and returns the first
+// failure.
+func verifyPackage(ctx context.Context, ex executor.Executor, pkg string, checks []catalog.Check) error {
+	for _, c := range checks {
+		if err := runCheck(ctx, ex, pkg, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyVersion checks that the version the step s left installed meets
+// the constraint of its package, which fails when the latest release
+// Homebrew installs is outside it.
+func verifyVersion(ctx context.Context, ex executor.Executor, s step) error {
+	pkg := catalog.Package{Name: s.pkg, Kind: s.kind, Version: s.version}
+	if s.brewPath {
+		ex = brewPathExecutor{ex}
+	}
+	if v := probe.CheckVersion(ctx, probe.Env{Exec: ex}, pkg); v.Status != probe.VersionOK {
+		return fmt.Errorf("la versión instalada %s no cumple %s", v.Installed, s.version)
+	}
+	return nil
+}
+
+// runCheck executes a single verification check of pkg.
+func runCheck(ctx context.Context, ex executor.Executor, pkg string, c catalog.Check) error {
+	name := c.Name
+	if name == "" {
+		name = pkg
+	}
+	switch c.Type {
+	case catalog.CheckBinary:
+		_, err := findBinary(ex, name)
+		return err
+	case catalog.CheckVersion:
+		path, err := findBinary(ex, name)
+		if err != nil {
+			return err
+		}
+		args := c.Args
+		if len(args) == 0 {
+			args = defaultVersionArgs
+		}
+		var out bytes.Buffer
+		cmd := executor.Command{Name: path, Args: args}
+		if err := ex.Run(ctx, cmd, &out); err != nil {
+			return fmt.Errorf("`%s %s` falló: %v", name, strings.Join(args, " "), err)
+		}
+		// Patterns were validated when the catalog was loaded.
+		if !regexp.MustCompile(c.Pattern).Match(out.Bytes()) {
+			return fmt.Errorf("la salida de `%s %s` no coincide con %q", name, strings.Join(args, " "), c.Pattern)
+		}
+		return nil
+	case catalog.CheckApp:
+		if !ex.Exists(c.Path) {
+			return fmt.Errorf("no se encontró %s", c.Path)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown check type %q", c.Type)
+}
+
+// findBinary returns the path of the executable name, looking in PATH and
+// then in the Homebrew bin directories.
+func findBinary(ex executor.Executor, name string) (string, error) {
+	if path, err := ex.LookPath(name); err == nil {
+		return path, nil
+	}
+	for _, dir := range brewBinDirs {
+		if path := filepath.Join(dir, name); ex.Exists(path) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s no está en el PATH", name)
+}